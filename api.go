@@ -0,0 +1,36 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"io"
+)
+
+// PixivAPI is the read api of pixiv, it is implemented by PixivClient and FakePixivAPI,
+// so that the consumers can swap the backend or mock it in the tests.
+type PixivAPI interface {
+	GetIllustInfo(illustId PixivID, onlyP0 bool) ([]*IllustInfo, error)
+	GetIllustInfoWithContext(ctx context.Context, illustId PixivID, onlyP0 bool) ([]*IllustInfo, error)
+	GetUserInfo(uid string, full bool) (*UserInfo, error)
+	GetUserInfoWithContext(ctx context.Context, uid string, full bool) (*UserInfo, error)
+	GetUserProfile(uid string, full bool) (*UserProfile, error)
+	GetUserProfileWithContext(ctx context.Context, uid string, full bool) (*UserProfile, error)
+	GetUserIllusts(uid string) ([]PixivID, error)
+	GetUserIllustsWithContext(ctx context.Context, uid string) ([]PixivID, error)
+	GetUserBookmarks(uid string, offset, limit int32) (*BookmarksInfo, error)
+	GetUserBookmarksWithContext(ctx context.Context, uid string, offset, limit int32) (*BookmarksInfo, error)
+	GetUserFollowing(uid string, offset, limit int32) (*FollowingInfo, error)
+	GetUserFollowingWithContext(ctx context.Context, uid string, offset, limit int32) (*FollowingInfo, error)
+	IllustRank(mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error)
+	IllustRankWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error)
+	GetIllust(url string) (io.ReadCloser, error)
+	GetIllustWithContext(ctx context.Context, url string) (io.ReadCloser, error)
+	GetIllustData(url string) ([]byte, error)
+	GetIllustDataWithContext(ctx context.Context, url string) ([]byte, error)
+	DownloadIllust(url, filename string) (int64, string, error)
+	DownloadIllustWithContext(ctx context.Context, url, filename string) (int64, string, error)
+}
+
+var (
+	_ PixivAPI = (*PixivClient)(nil)
+	_ PixivAPI = (*FakePixivAPI)(nil)
+)
@@ -0,0 +1,586 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultAppApiBaseUrl = "https://app-api.pixiv.net"
+
+const (
+	appIllustDetailPath   = "/v1/illust/detail"
+	appUserIllustsPath    = "/v1/user/illusts"
+	appUserBookmarksPath  = "/v1/user/bookmarks/illust"
+	appUserFollowingPath  = "/v1/user/following"
+	appIllustRankingPath  = "/v1/illust/ranking"
+	appSearchIllustPath   = "/v1/search/illust"
+	appUgoiraMetadataPath = "/v1/ugoira/metadata"
+	appNovelTextPath      = "/webview/v2/novel"
+)
+
+const (
+	appUserAgent = "PixivIOSApp/7.13.3 (iOS 14.6; iPhone13,2)"
+	appOS        = "ios"
+	appOSVersion = "14.6"
+)
+
+// The logical endpoint names of the app api passed to the middlewares
+const (
+	EndpointAppIllustDetail   = "app.illust.detail"
+	EndpointAppUserIllusts    = "app.user.illusts"
+	EndpointAppUserBookmarks  = "app.user.bookmarks"
+	EndpointAppUserFollowing  = "app.user.following"
+	EndpointAppIllustRanking  = "app.illust.ranking"
+	EndpointAppSearchIllust   = "app.search.illust"
+	EndpointAppUgoiraMetadata = "app.ugoira.metadata"
+	EndpointAppNovelText      = "app.novel.text"
+)
+
+// appRankMode map the web ranking mode to the app api mode
+var appRankMode = map[IllustRankMode]string{
+	IllustRankModeDaily:      "day",
+	IllustRankModeWeekly:     "week",
+	IllustRankModeMonthly:    "month",
+	IllustRankModeRookie:     "week_rookie",
+	IllustRankModeDailyAi:    "day_ai",
+	IllustRankModeMale:       "day_male",
+	IllustRankModeFemale:     "day_female",
+	IllustRankModeDailyR18:   "day_r18",
+	IllustRankModeWeeklyR18:  "week_r18",
+	IllustRankModeDailyR18Ai: "day_r18_ai",
+	IllustRankModeMaleR18:    "day_male_r18",
+	IllustRankModeFemaleR18:  "day_female_r18",
+	IllustRankModeR18g:       "week_r18g",
+}
+
+// AppClient is a client of the pixiv app api (app-api.pixiv.net) authenticated by an
+// OAuthClient, it maps the responses onto the same models as PixivClient. The requests
+// are sent by the PixivClient, so its proxies, retries, rate limits and middlewares apply,
+// but its cookies are never sent.
+type AppClient struct {
+	client  *PixivClient
+	auth    *OAuthClient
+	baseUrl string
+}
+
+func NewAppClient(client *PixivClient, auth *OAuthClient) *AppClient {
+	return &AppClient{client: client, auth: auth, baseUrl: DefaultAppApiBaseUrl}
+}
+
+// SetBaseUrl override the app api base url, e.g. a local test server
+func (a *AppClient) SetBaseUrl(baseUrl string) {
+	a.baseUrl = strings.TrimSuffix(baseUrl, "/")
+}
+
+// AppIllustList is a page of illusts, NextUrl is empty on the last page
+type AppIllustList struct {
+	Illusts []*IllustInfo
+	NextUrl string
+}
+
+// AppUserList is a page of users, NextUrl is empty on the last page
+type AppUserList struct {
+	Users   []*UserInfo
+	NextUrl string
+}
+
+// isInvalidGrant reports whether the app api rejected the access token
+func isInvalidGrant(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest &&
+		strings.Contains(httpErr.Body, "invalid_grant")
+}
+
+// get send the request with the access token, the token is refreshed and the request is
+// sent again once if the app api rejects the token
+func (a *AppClient) get(ctx context.Context, endpoint, urlStr string) ([]byte, error) {
+	accessToken, err := a.auth.AccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.getOnce(ctx, endpoint, urlStr, accessToken)
+	if isInvalidGrant(err) {
+		token, err := a.auth.refreshRejected(ctx, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		return a.getOnce(ctx, endpoint, urlStr, token.AccessToken)
+	}
+	return body, err
+}
+
+func (a *AppClient) getOnce(ctx context.Context, endpoint, urlStr, accessToken string) ([]byte, error) {
+	lang := a.client.requestLang(ctx)
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		req.Header.Set("User-Agent", appUserAgent)
+		req.Header.Set("App-OS", appOS)
+		req.Header.Set("App-OS-Version", appOSVersion)
+		if len(lang) > 0 {
+			req.Header.Set("Accept-Language", lang)
+		}
+		setClientHashHeader(req.Header, time.Now())
+		return req, nil
+	}
+	resp, err := a.client.do(ctx, endpoint, newReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	return io.ReadAll(resp.Body)
+}
+
+func (a *AppClient) url(path string, params url.Values) string {
+	return a.baseUrl + path + "?" + params.Encode()
+}
+
+// next check the next url is on the app api host, so the token is never sent to other hosts
+func (a *AppClient) next(nextUrl string) (string, error) {
+	if !strings.HasPrefix(nextUrl, a.baseUrl+"/") {
+		return "", errors.New("the next url is not an app api url: " + nextUrl)
+	}
+	return nextUrl, nil
+}
+
+// appIllust is the illust of the app api
+type appIllust struct {
+	Id        PixivID `json:"id"`
+	Title     string  `json:"title"`
+	Type      string  `json:"type"`
+	ImageUrls struct {
+		SquareMedium string `json:"square_medium"`
+		Medium       string `json:"medium"`
+		Large        string `json:"large"`
+	} `json:"image_urls"`
+	Caption  string        `json:"caption"`
+	Restrict RestrictLevel `json:"restrict"`
+	User     appUser       `json:"user"`
+	Tags     []struct {
+		Name           string `json:"name"`
+		TranslatedName string `json:"translated_name"`
+	} `json:"tags"`
+	CreateDate     time.Time       `json:"create_date"`
+	PageCount      int             `json:"page_count"`
+	Width          int             `json:"width"`
+	Height         int             `json:"height"`
+	SanityLevel    SanityLevelCode `json:"sanity_level"`
+	XRestrict      XRestrictLevel  `json:"x_restrict"`
+	MetaSinglePage struct {
+		OriginalImageUrl string `json:"original_image_url"`
+	} `json:"meta_single_page"`
+	MetaPages []struct {
+		ImageUrls struct {
+			SquareMedium string `json:"square_medium"`
+			Medium       string `json:"medium"`
+			Large        string `json:"large"`
+			Original     string `json:"original"`
+		} `json:"image_urls"`
+	} `json:"meta_pages"`
+	TotalView      int        `json:"total_view"`
+	TotalBookmarks int        `json:"total_bookmarks"`
+	TotalComments  int        `json:"total_comments"`
+	IsBookmarked   bool       `json:"is_bookmarked"`
+	IllustAiType   AITypeCode `json:"illust_ai_type"`
+}
+
+type appUser struct {
+	Id               PixivID `json:"id"`
+	Name             string  `json:"name"`
+	Account          string  `json:"account"`
+	ProfileImageUrls struct {
+		Medium string `json:"medium"`
+	} `json:"profile_image_urls"`
+}
+
+func (u *appUser) toUserInfo() UserInfo {
+	return UserInfo{UserId: u.Id, UserName: u.Name, UserAccount: u.Account}
+}
+
+var appIllustType = map[string]IllustTypeCode{
+	"illust": IllustTypeIllust,
+	"manga":  IllustTypeManga,
+	"ugoira": IllustTypeUgoira,
+}
+
+// toIllustInfo convert the app illust to the first page IllustInfo
+func (ai *appIllust) toIllustInfo() *IllustInfo {
+	illust := &IllustInfo{
+		Id:          ai.Id,
+		Title:       ai.Title,
+		Description: ai.Caption,
+		IllustType:  appIllustType[ai.Type],
+		CreateDate:  ai.CreateDate,
+		UploadDate:  ai.CreateDate,
+		Restrict:    ai.Restrict,
+		XRestrict:   ai.XRestrict,
+		SanityLevel: ai.SanityLevel,
+		Urls: Urls{
+			Thumb:    ai.ImageUrls.SquareMedium,
+			Small:    ai.ImageUrls.Medium,
+			Regular:  ai.ImageUrls.Large,
+			Original: ai.MetaSinglePage.OriginalImageUrl,
+		},
+		Width:         ai.Width,
+		Height:        ai.Height,
+		PageCount:     ai.PageCount,
+		BookmarkCount: ai.TotalBookmarks,
+		CommentCount:  ai.TotalComments,
+		ViewCount:     ai.TotalView,
+		AiType:        ai.IllustAiType,
+		UserInfo:      ai.User.toUserInfo(),
+	}
+	if len(ai.MetaPages) > 0 {
+		illust.Urls.Original = ai.MetaPages[0].ImageUrls.Original
+	}
+	if ai.IsBookmarked {
+		illust.BookmarkDate = &BookmarkDate{}
+	}
+
+	r18 := false
+	for _, tag := range ai.Tags {
+		if tag.Name == "R-18" {
+			r18 = true
+		}
+		illust.Tags = append(illust.Tags, tag.Name)
+		illust.TransTags = append(illust.TransTags, tag.TranslatedName)
+	}
+	illust.R18 = r18 || illust.XRestrict >= XRestrictLevelR18
+	return illust
+}
+
+// toIllustPages convert the app illust to the IllustInfo of every page, the size of the
+// pages except the first one is unknown in the app api
+func (ai *appIllust) toIllustPages() []*IllustInfo {
+	seed := ai.toIllustInfo()
+	if len(ai.MetaPages) <= 1 {
+		return []*IllustInfo{seed}
+	}
+	illusts := make([]*IllustInfo, 0, len(ai.MetaPages))
+	for idx, page := range ai.MetaPages {
+		illust := *seed
+		illust.PageIdx = idx
+		illust.Urls = Urls{
+			Thumb:    page.ImageUrls.SquareMedium,
+			Small:    page.ImageUrls.Medium,
+			Regular:  page.ImageUrls.Large,
+			Original: page.ImageUrls.Original,
+		}
+		if idx > 0 {
+			illust.Width = 0
+			illust.Height = 0
+		}
+		illusts = append(illusts, &illust)
+	}
+	return illusts
+}
+
+func (a *AppClient) getIllustList(ctx context.Context, endpoint, urlStr string) (*AppIllustList, error) {
+	body, err := a.get(ctx, endpoint, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Illusts []*appIllust `json:"illusts"`
+		NextUrl string       `json:"next_url"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, NewJsonUnmarshalErr(body, err)
+	}
+	list := &AppIllustList{NextUrl: resp.NextUrl}
+	for _, ai := range resp.Illusts {
+		list.Illusts = append(list.Illusts, ai.toIllustInfo())
+	}
+	return list, nil
+}
+
+// IllustDetail get the illust detail, for a multi page illust, only the first page will be
+// returned if onlyP0 is true
+func (a *AppClient) IllustDetail(illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
+	return a.IllustDetailWithContext(context.Background(), illustId, onlyP0)
+}
+
+// IllustDetailWithContext is like IllustDetail but with a context
+func (a *AppClient) IllustDetailWithContext(ctx context.Context, illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
+	params := url.Values{}
+	params.Set("illust_id", string(illustId))
+	body, err := a.get(ctx, EndpointAppIllustDetail, a.url(appIllustDetailPath, params))
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Illust *appIllust `json:"illust"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, NewJsonUnmarshalErr(body, err)
+	}
+	if resp.Illust == nil {
+		return nil, ErrNotFound
+	}
+	if onlyP0 {
+		return []*IllustInfo{resp.Illust.toIllustInfo()}, nil
+	}
+	return resp.Illust.toIllustPages(), nil
+}
+
+// UserIllusts get the illusts of the user, illustType is "illust" or "manga"
+func (a *AppClient) UserIllusts(uid string, illustType string, offset int) (*AppIllustList, error) {
+	return a.UserIllustsWithContext(context.Background(), uid, illustType, offset)
+}
+
+// UserIllustsWithContext is like UserIllusts but with a context
+func (a *AppClient) UserIllustsWithContext(ctx context.Context, uid string, illustType string, offset int) (*AppIllustList, error) {
+	params := url.Values{}
+	params.Set("user_id", uid)
+	params.Set("type", illustType)
+	params.Set("filter", "for_ios")
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	return a.getIllustList(ctx, EndpointAppUserIllusts, a.url(appUserIllustsPath, params))
+}
+
+// UserBookmarks get the bookmarked illusts of the user, restrict is "public" or "private"
+func (a *AppClient) UserBookmarks(uid string, restrict string) (*AppIllustList, error) {
+	return a.UserBookmarksWithContext(context.Background(), uid, restrict)
+}
+
+// UserBookmarksWithContext is like UserBookmarks but with a context
+func (a *AppClient) UserBookmarksWithContext(ctx context.Context, uid string, restrict string) (*AppIllustList, error) {
+	params := url.Values{}
+	params.Set("user_id", uid)
+	params.Set("restrict", restrict)
+	params.Set("filter", "for_ios")
+	return a.getIllustList(ctx, EndpointAppUserBookmarks, a.url(appUserBookmarksPath, params))
+}
+
+// SearchIllust search the illusts whose tags partially match the word, newest first
+func (a *AppClient) SearchIllust(word string, offset int) (*AppIllustList, error) {
+	return a.SearchIllustWithContext(context.Background(), word, offset)
+}
+
+// SearchIllustWithContext is like SearchIllust but with a context
+func (a *AppClient) SearchIllustWithContext(ctx context.Context, word string, offset int) (*AppIllustList, error) {
+	params := url.Values{}
+	params.Set("word", word)
+	params.Set("search_target", "partial_match_for_tags")
+	params.Set("sort", "date_desc")
+	params.Set("filter", "for_ios")
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	return a.getIllustList(ctx, EndpointAppSearchIllust, a.url(appSearchIllustPath, params))
+}
+
+// NextIllusts get the next page of UserIllusts, UserBookmarks or SearchIllust by the NextUrl
+func (a *AppClient) NextIllusts(list *AppIllustList) (*AppIllustList, error) {
+	return a.NextIllustsWithContext(context.Background(), list)
+}
+
+// NextIllustsWithContext is like NextIllusts but with a context
+func (a *AppClient) NextIllustsWithContext(ctx context.Context, list *AppIllustList) (*AppIllustList, error) {
+	nextUrl, err := a.next(list.NextUrl)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := EndpointAppUserIllusts
+	if strings.Contains(nextUrl, appUserBookmarksPath) {
+		endpoint = EndpointAppUserBookmarks
+	} else if strings.Contains(nextUrl, appSearchIllustPath) {
+		endpoint = EndpointAppSearchIllust
+	}
+	return a.getIllustList(ctx, endpoint, nextUrl)
+}
+
+// UserFollowing get the users followed by the user, restrict is "public" or "private"
+func (a *AppClient) UserFollowing(uid string, restrict string, offset int) (*AppUserList, error) {
+	return a.UserFollowingWithContext(context.Background(), uid, restrict, offset)
+}
+
+// UserFollowingWithContext is like UserFollowing but with a context
+func (a *AppClient) UserFollowingWithContext(ctx context.Context, uid string, restrict string, offset int) (*AppUserList, error) {
+	params := url.Values{}
+	params.Set("user_id", uid)
+	params.Set("restrict", restrict)
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	return a.getUserList(ctx, a.url(appUserFollowingPath, params))
+}
+
+// NextUsers get the next page of UserFollowing by the NextUrl
+func (a *AppClient) NextUsers(list *AppUserList) (*AppUserList, error) {
+	return a.NextUsersWithContext(context.Background(), list)
+}
+
+// NextUsersWithContext is like NextUsers but with a context
+func (a *AppClient) NextUsersWithContext(ctx context.Context, list *AppUserList) (*AppUserList, error) {
+	nextUrl, err := a.next(list.NextUrl)
+	if err != nil {
+		return nil, err
+	}
+	return a.getUserList(ctx, nextUrl)
+}
+
+func (a *AppClient) getUserList(ctx context.Context, urlStr string) (*AppUserList, error) {
+	body, err := a.get(ctx, EndpointAppUserFollowing, urlStr)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		UserPreviews []struct {
+			User appUser `json:"user"`
+		} `json:"user_previews"`
+		NextUrl string `json:"next_url"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, NewJsonUnmarshalErr(body, err)
+	}
+	list := &AppUserList{NextUrl: resp.NextUrl}
+	for _, preview := range resp.UserPreviews {
+		user := preview.User.toUserInfo()
+		list.Users = append(list.Users, &user)
+	}
+	return list, nil
+}
+
+// IllustRank get the illust rank, the mode is the same as PixivClient.IllustRank, date format: 20230118,
+// page starts from 1. The content of the app api rank is always IllustRankContentAll.
+func (a *AppClient) IllustRank(mode IllustRankMode, date string, page int) (*IllustRankInfo, error) {
+	return a.IllustRankWithContext(context.Background(), mode, date, page)
+}
+
+// IllustRankWithContext is like IllustRank but with a context
+func (a *AppClient) IllustRankWithContext(ctx context.Context, mode IllustRankMode, date string, page int) (*IllustRankInfo, error) {
+	appMode, ok := appRankMode[mode]
+	if !ok {
+		return nil, errors.New("unsupported rank mode: " + string(mode))
+	}
+	if page < 1 {
+		page = 1
+	}
+	const pageSize = 30
+	offset := (page - 1) * pageSize
+
+	params := url.Values{}
+	params.Set("mode", appMode)
+	params.Set("filter", "for_ios")
+	if len(date) == 8 {
+		params.Set("date", date[:4]+"-"+date[4:6]+"-"+date[6:])
+	} else if len(date) > 0 {
+		params.Set("date", date)
+	}
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	list, err := a.getIllustList(ctx, EndpointAppIllustRanking, a.url(appIllustRankingPath, params))
+	if err != nil {
+		return nil, err
+	}
+
+	rank := &IllustRankInfo{
+		Mode:    mode,
+		Content: IllustRankContentAll,
+		Page:    RankPageType(page),
+		Prev:    RankPageType(page - 1),
+		Date:    RankDateType(date),
+	}
+	if len(list.NextUrl) > 0 {
+		rank.Next = RankPageType(page + 1)
+	}
+	for idx, illust := range list.Illusts {
+		rank.Contents = append(rank.Contents, &IllustRankItem{
+			Title:                 illust.Title,
+			Date:                  illust.CreateDate.Format("2006年01月02日 15:04"),
+			Tags:                  illust.Tags,
+			Url:                   illust.Urls.Regular,
+			IllustType:            strconv.Itoa(int(illust.IllustType)),
+			IllustPageCount:       strconv.Itoa(illust.PageCount),
+			UserName:              illust.UserName,
+			IllustId:              illust.Id,
+			Width:                 illust.Width,
+			Height:                illust.Height,
+			UserId:                illust.UserId,
+			Rank:                  offset + idx + 1,
+			ViewCount:             illust.ViewCount,
+			IllustUploadTimestamp: int(illust.CreateDate.Unix()),
+			IsBookmarked:          illust.BookmarkDate != nil,
+			Bookmarkable:          true,
+		})
+	}
+	rank.RankTotal = len(rank.Contents)
+	return rank, nil
+}
+
+// UgoiraMetadata get the zip url and the frames of an ugoira
+func (a *AppClient) UgoiraMetadata(illustId PixivID) (*UgoiraMetadata, error) {
+	return a.UgoiraMetadataWithContext(context.Background(), illustId)
+}
+
+// UgoiraMetadataWithContext is like UgoiraMetadata but with a context
+func (a *AppClient) UgoiraMetadataWithContext(ctx context.Context, illustId PixivID) (*UgoiraMetadata, error) {
+	params := url.Values{}
+	params.Set("illust_id", string(illustId))
+	body, err := a.get(ctx, EndpointAppUgoiraMetadata, a.url(appUgoiraMetadataPath, params))
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		UgoiraMetadata struct {
+			ZipUrls struct {
+				Medium string `json:"medium"`
+			} `json:"zip_urls"`
+			Frames []UgoiraFrame `json:"frames"`
+		} `json:"ugoira_metadata"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, NewJsonUnmarshalErr(body, err)
+	}
+	return &UgoiraMetadata{
+		ZipUrl: resp.UgoiraMetadata.ZipUrls.Medium,
+		Frames: resp.UgoiraMetadata.Frames,
+	}, nil
+}
+
+// novelJsonRegexp find the novel json in the webview html
+var novelJsonRegexp = regexp.MustCompile(`novel:\s*(\{.+\}),\s*isOwnWork`)
+
+// NovelText get the text of a novel
+func (a *AppClient) NovelText(novelId PixivID) (string, error) {
+	return a.NovelTextWithContext(context.Background(), novelId)
+}
+
+// NovelTextWithContext is like NovelText but with a context
+func (a *AppClient) NovelTextWithContext(ctx context.Context, novelId PixivID) (string, error) {
+	params := url.Values{}
+	params.Set("id", string(novelId))
+	params.Set("viewer_version", "20221031_ai")
+	body, err := a.get(ctx, EndpointAppNovelText, a.url(appNovelTextPath, params))
+	if err != nil {
+		return "", err
+	}
+	match := novelJsonRegexp.FindSubmatch(body)
+	if match == nil {
+		return "", NewJsonUnmarshalErr(body, errors.New("no novel json found in the webview"))
+	}
+	var novel struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(match[1], &novel); err != nil {
+		return "", NewJsonUnmarshalErr(match[1], err)
+	}
+	return novel.Text, nil
+}
@@ -0,0 +1,109 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAppClient(t *testing.T) {
+	var refreshed int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshed, 1)
+		_, _ = w.Write([]byte(`{"access_token":"access2","expires_in":3600,"refresh_token":"refresh1"}`))
+	})
+	mux.HandleFunc("/v1/illust/detail", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access2" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"Error occurred at the OAuth process. Error Message: invalid_grant"}}`))
+			return
+		}
+		if r.Header.Get("Cookie") != "" || r.Header.Get("X-Client-Hash") == "" || r.Header.Get("App-OS") != appOS {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"illust":{"id":102050100,"title":"title","type":"manga","image_urls":{"large":"l0"},
+"user":{"id":1,"name":"neko","account":"littleneko"},"tags":[{"name":"R-18","translated_name":null},{"name":"tag","translated_name":"trans"}],
+"create_date":"2023-01-18T00:00:00+09:00","page_count":2,"width":100,"height":200,"x_restrict":1,
+"meta_single_page":{},"meta_pages":[{"image_urls":{"large":"l0","original":"o0"}},{"image_urls":{"large":"l1","original":"o1"}}],
+"total_bookmarks":10,"is_bookmarked":true}}`))
+	})
+	mux.HandleFunc("/v1/illust/ranking", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("mode") != "day" || r.FormValue("date") != "2023-01-18" || r.FormValue("offset") != "30" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"illusts":[{"id":1,"type":"illust","page_count":1,"user":{"id":2}}],"next_url":"next"}`))
+	})
+	mux.HandleFunc("/v1/user/following", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"user_previews":[{"user":{"id":3,"name":"a","account":"b"}}],"next_url":null}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := &MemoryTokenStore{}
+	_ = store.Save(&OAuthToken{AccessToken: "access1", RefreshToken: "refresh1", ExpiresAt: time.Now().Add(time.Hour)})
+	pc := NewPixivClient(5000)
+	pc.SetCookiePHPSESSID("secret")
+	auth := NewOAuthClient(pc, store)
+	auth.SetUrls(server.URL+"/auth/token", "")
+	app := NewAppClient(pc, auth)
+	app.SetBaseUrl(server.URL)
+
+	// the requests rejected together refresh the token once
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := app.IllustDetailWithContext(ctx, "102050100", false); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshed != 1 {
+		t.Errorf("expected 1 refresh, acture: %d", refreshed)
+	}
+
+	illusts, err := app.IllustDetailWithContext(ctx, "102050100", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(illusts) != 2 {
+		t.Fatalf("expected 2 pages, acture: %d", len(illusts))
+	}
+	p1 := illusts[1]
+	if p1.PageIdx != 1 || p1.Urls.Original != "o1" || p1.IllustType != IllustTypeManga || !p1.R18 ||
+		p1.UserId != "1" || p1.BookmarkCount != 10 || p1.BookmarkDate == nil || p1.TransTags[1] != "trans" {
+		t.Errorf("unexpected illust: %+v", p1)
+	}
+	if illusts[0].Width != 100 || illusts[0].Urls.Original != "o0" {
+		t.Errorf("unexpected illust: %+v", illusts[0])
+	}
+
+	rank, err := app.IllustRank(IllustRankModeDaily, "20230118", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank.Next != 3 || len(rank.Contents) != 1 || rank.Contents[0].Rank != 31 || rank.Contents[0].UserId != "2" {
+		t.Errorf("unexpected rank: %+v", rank)
+	}
+
+	users, err := app.UserFollowingWithContext(ctx, "1", "public", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users.Users) != 1 || users.Users[0].UserAccount != "b" || users.NextUrl != "" {
+		t.Errorf("unexpected users: %+v", users)
+	}
+	if _, err := app.NextUsersWithContext(ctx, &AppUserList{NextUrl: "https://example.com/v1/user/following"}); err == nil {
+		t.Errorf("expected error for a foreign next url")
+	}
+}
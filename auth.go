@@ -0,0 +1,380 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultOAuthTokenUrl = "https://oauth.secure.pixiv.net/auth/token"
+	DefaultOAuthLoginUrl = "https://app-api.pixiv.net/web/v1/login"
+
+	oauthClientId     = "MOBrBDS8blbauoSck0ZfDbtuzpyT"
+	oauthClientSecret = "lsACyCD94FhDUtGTXi3QzcFE2uU1hqtDaKeqrdwj"
+	oauthRedirectUri  = "https://app-api.pixiv.net/web/v1/users/auth/pixiv/callback"
+	oauthUserAgent    = "PixivAndroidApp/5.0.234 (Android 11; Pixel 5)"
+	clientHashSecret  = "28c1fdd170a5204386cb1313c7077b34f83e4aaf4aa829ce78c231e05b0bae2c"
+
+	// tokenExpiryMargin refresh the access token a bit before it really expires
+	tokenExpiryMargin = time.Minute
+)
+
+// setClientHashHeader set the X-Client-Time and X-Client-Hash headers required by the app api,
+// the hash is md5(time + secret)
+func setClientHashHeader(header http.Header, now time.Time) {
+	clientTime := now.Format("2006-01-02T15:04:05-07:00")
+	sum := md5.Sum([]byte(clientTime + clientHashSecret))
+	header.Set("X-Client-Time", clientTime)
+	header.Set("X-Client-Hash", hex.EncodeToString(sum[:]))
+}
+
+// OAuthToken is the token of the pixiv app api
+type OAuthToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UserInfo
+}
+
+// Valid reports whether the access token exists and will not expire in a minute
+func (t *OAuthToken) Valid() bool {
+	return t != nil && len(t.AccessToken) > 0 && time.Now().Add(tokenExpiryMargin).Before(t.ExpiresAt)
+}
+
+// TokenStore persist the token, so that the refresh token survives restarts
+type TokenStore interface {
+	// Load return the saved token, nil without error if there is none
+	Load() (*OAuthToken, error)
+	Save(token *OAuthToken) error
+}
+
+// MemoryTokenStore keep the token in memory only
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	token *OAuthToken
+}
+
+func (s *MemoryTokenStore) Load() (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == nil {
+		return nil, nil
+	}
+	token := *s.token
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Save(token *OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := *token
+	s.token = &t
+	return nil
+}
+
+// FileTokenStore save the token in a json file only readable by the owner
+type FileTokenStore struct {
+	Filename string
+}
+
+func (s *FileTokenStore) Load() (*OAuthToken, error) {
+	data, err := os.ReadFile(s.Filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var token OAuthToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, NewJsonUnmarshalErr(nil, err)
+	}
+	return &token, nil
+}
+
+func (s *FileTokenStore) Save(token *OAuthToken) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Filename, data, 0600)
+}
+
+// PKCE is the code verifier and challenge of the OAuth authorization code flow with PKCE
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE generate a random code verifier and its S256 challenge
+func NewPKCE() (*PKCE, error) {
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return &PKCE{Verifier: verifier, Challenge: base64.RawURLEncoding.EncodeToString(sum[:])}, nil
+}
+
+// OAuthClient implement the pixiv OAuth authorization code with PKCE flow and the
+// refresh_token grant, the access token is renewed automatically when it expires.
+//
+// How to login:
+//
+//	pkce, _ := NewPKCE()
+//	// open auth.LoginUrl(pkce) in a browser and login, get the code from the callback
+//	// url pixiv://account/login?code=...
+//	token, err := auth.ExchangeCode(ctx, code, pkce.Verifier)
+//
+// The token is saved in the TokenStore, the later runs only need AccessToken.
+type OAuthClient struct {
+	client   *PixivClient
+	store    TokenStore
+	tokenUrl string
+	loginUrl string
+
+	mu    sync.Mutex
+	token *OAuthToken
+	// refreshMu serialize the refreshes of Token
+	refreshMu sync.Mutex
+}
+
+// NewOAuthClient create an OAuthClient sending the requests by the client, so the proxies,
+// retries and middlewares of the client apply. A MemoryTokenStore is used if store is nil.
+func NewOAuthClient(client *PixivClient, store TokenStore) *OAuthClient {
+	if store == nil {
+		store = &MemoryTokenStore{}
+	}
+	return &OAuthClient{
+		client:   client,
+		store:    store,
+		tokenUrl: DefaultOAuthTokenUrl,
+		loginUrl: DefaultOAuthLoginUrl,
+	}
+}
+
+// SetUrls override the token and login urls, the empty url means the default one
+func (o *OAuthClient) SetUrls(tokenUrl, loginUrl string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.tokenUrl = DefaultOAuthTokenUrl
+	if len(tokenUrl) > 0 {
+		o.tokenUrl = tokenUrl
+	}
+	o.loginUrl = DefaultOAuthLoginUrl
+	if len(loginUrl) > 0 {
+		o.loginUrl = loginUrl
+	}
+}
+
+// LoginUrl return the url to open in a browser to login with the PKCE challenge
+func (o *OAuthClient) LoginUrl(pkce *PKCE) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	params := url.Values{}
+	params.Set("code_challenge", pkce.Challenge)
+	params.Set("code_challenge_method", "S256")
+	params.Set("client", "pixiv-android")
+	return o.loginUrl + "?" + params.Encode()
+}
+
+// ExchangeCode exchange the authorization code for the token and save it
+func (o *OAuthClient) ExchangeCode(ctx context.Context, code, verifier string) (*OAuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	form.Set("redirect_uri", oauthRedirectUri)
+	return o.requestToken(ctx, form)
+}
+
+// LoginWithRefreshToken get a new token by the refresh token, e.g. copied from another device
+func (o *OAuthClient) LoginWithRefreshToken(ctx context.Context, refreshToken string) (*OAuthToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return o.requestToken(ctx, form)
+}
+
+// Refresh renew the access token by the refresh token of the current token
+func (o *OAuthClient) Refresh(ctx context.Context) (*OAuthToken, error) {
+	token, err := o.loadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || len(token.RefreshToken) == 0 {
+		return nil, ErrLoginRequired
+	}
+	return o.LoginWithRefreshToken(ctx, token.RefreshToken)
+}
+
+// Token return a valid token, it is refreshed if expired. ErrLoginRequired is returned if
+// there is no token at all.
+func (o *OAuthClient) Token(ctx context.Context) (*OAuthToken, error) {
+	o.mu.Lock()
+	token := o.token
+	o.mu.Unlock()
+	if token.Valid() {
+		return token, nil
+	}
+
+	// serialize the refreshes, the token may have been refreshed while waiting
+	o.refreshMu.Lock()
+	defer o.refreshMu.Unlock()
+	token, err := o.loadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token.Valid() {
+		return token, nil
+	}
+	return o.Refresh(ctx)
+}
+
+// refreshRejected refresh the token rejected by the server, serialized with Token. The token
+// is not refreshed again if it has been changed since the rejected one was got, so that
+// the concurrent requests rejected together refresh it only once.
+func (o *OAuthClient) refreshRejected(ctx context.Context, rejected string) (*OAuthToken, error) {
+	o.refreshMu.Lock()
+	defer o.refreshMu.Unlock()
+	token, err := o.loadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token.Valid() && token.AccessToken != rejected {
+		return token, nil
+	}
+	return o.Refresh(ctx)
+}
+
+// AccessToken return a valid access token, see Token
+func (o *OAuthClient) AccessToken(ctx context.Context) (string, error) {
+	token, err := o.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// loadToken return the current token, it is loaded from the store at the first time
+func (o *OAuthClient) loadToken() (*OAuthToken, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.token != nil {
+		return o.token, nil
+	}
+	token, err := o.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	o.token = token
+	return token, nil
+}
+
+func (o *OAuthClient) requestToken(ctx context.Context, form url.Values) (*OAuthToken, error) {
+	form.Set("client_id", oauthClientId)
+	form.Set("client_secret", oauthClientSecret)
+	form.Set("include_policy", "true")
+	o.mu.Lock()
+	tokenUrl := o.tokenUrl
+	o.mu.Unlock()
+
+	newReq := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", tokenUrl, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", oauthUserAgent)
+		setClientHashHeader(req.Header, time.Now())
+		return req, nil
+	}
+	resp, err := o.client.do(ctx, EndpointOAuthToken, newReq)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	/**
+	The json format of the response, the old api wraps it in "response":
+
+	{
+	    "access_token": "...",
+	    "expires_in": 3600,
+	    "token_type": "bearer",
+	    "refresh_token": "...",
+	    "user": {"id": "4495110", "name": "neko", "account": "littleneko"}
+	}
+	*/
+	type tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		User         struct {
+			Id      PixivID `json:"id"`
+			Name    string  `json:"name"`
+			Account string  `json:"account"`
+		} `json:"user"`
+	}
+	var tr struct {
+		tokenResp
+		Response *tokenResp `json:"response"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil {
+		// never put the raw body in the error, it may contain the tokens
+		return nil, NewJsonUnmarshalErr(nil, err)
+	}
+	t := tr.tokenResp
+	if tr.Response != nil {
+		t = *tr.Response
+	}
+	if len(t.AccessToken) == 0 {
+		return nil, &PixivAPIError{Message: "no access_token in the token response", URL: tokenUrl}
+	}
+
+	token := &OAuthToken{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(t.ExpiresIn) * time.Second),
+		UserInfo: UserInfo{
+			UserId:      t.User.Id,
+			UserName:    t.User.Name,
+			UserAccount: t.User.Account,
+		},
+	}
+	if old, _ := o.loadToken(); old != nil {
+		// the refresh response may omit the refresh token or the user
+		if len(token.RefreshToken) == 0 {
+			token.RefreshToken = old.RefreshToken
+		}
+		if len(token.UserId) == 0 {
+			token.UserInfo = old.UserInfo
+		}
+	}
+	if err := o.store.Save(token); err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	o.token = token
+	o.mu.Unlock()
+	return token, nil
+}
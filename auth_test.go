@@ -0,0 +1,91 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOAuthClient(t *testing.T) {
+	var refreshed int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Client-Hash") == "" || r.FormValue("client_id") != oauthClientId {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.FormValue("grant_type") {
+		case "authorization_code":
+			if r.FormValue("code") != "code" || r.FormValue("code_verifier") != "verifier" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// expires immediately so that the next Token call refreshes it
+			_, _ = w.Write([]byte(`{"access_token":"access1","expires_in":0,"refresh_token":"refresh1","user":{"id":"1","name":"neko","account":"littleneko"}}`))
+		case "refresh_token":
+			if r.FormValue("refresh_token") != "refresh1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			n := atomic.AddInt32(&refreshed, 1)
+			_, _ = fmt.Fprintf(w, `{"response":{"access_token":"access%d","expires_in":3600,"refresh_token":"refresh1"}}`, n+1)
+		}
+	}))
+	defer server.Close()
+
+	store := &FileTokenStore{Filename: filepath.Join(t.TempDir(), "token.json")}
+	auth := NewOAuthClient(NewPixivClient(5000), store)
+	auth.SetUrls(server.URL, "")
+
+	ctx := context.Background()
+	if _, err := auth.Token(ctx); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("expected: %v, acture: %v", ErrLoginRequired, err)
+	}
+
+	token, err := auth.ExchangeCode(ctx, "code", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access1" || token.UserId != "1" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	for i := 0; i < 3; i++ {
+		accessToken, err := auth.AccessToken(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accessToken != "access2" {
+			t.Errorf("expected: access2, acture: %s", accessToken)
+		}
+	}
+	if refreshed != 1 {
+		t.Errorf("expected 1 refresh, acture: %d", refreshed)
+	}
+
+	// a new client loads the token from the store
+	saved, err := NewOAuthClient(NewPixivClient(5000), store).Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.AccessToken != "access2" || saved.RefreshToken != "refresh1" {
+		t.Errorf("unexpected saved token: %+v", saved)
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(pkce.Verifier))
+	if pkce.Challenge != base64.RawURLEncoding.EncodeToString(sum[:]) || len(pkce.Verifier) < 43 {
+		t.Errorf("unexpected pkce: %+v", pkce)
+	}
+}
@@ -0,0 +1,185 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	// BreakerClosed let all the requests pass
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fail all the requests fast with CircuitOpenError
+	BreakerOpen
+	// BreakerHalfOpen let a few probe requests pass to check whether the host recovered
+	BreakerHalfOpen
+)
+
+var breakerStateName = map[BreakerState]string{
+	BreakerClosed:   "Closed",
+	BreakerOpen:     "Open",
+	BreakerHalfOpen: "HalfOpen",
+}
+
+func (s BreakerState) String() string {
+	if v, ok := breakerStateName[s]; ok {
+		return v
+	}
+	return "UNKNOWN"
+}
+
+func (s BreakerState) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+// BreakerConfig configure the circuit breaker of every upstream host
+type BreakerConfig struct {
+	// FailureThreshold is the consecutive failures opening the breaker, default 5
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before allowing probes, default 30s
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the max concurrent probe requests in half open state, default 1
+	HalfOpenProbes int
+}
+
+func (c BreakerConfig) withDefault() BreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenProbes <= 0 {
+		c.HalfOpenProbes = 1
+	}
+	return c
+}
+
+// CircuitOpenError is returned without sending the request when the breaker of the host is open
+type CircuitOpenError struct {
+	Host string
+	// RetryAt is when the breaker will allow probe requests
+	RetryAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of %s is open, retry at %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type circuitBreaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// breakerGroup hold a circuit breaker per host
+type breakerGroup struct {
+	mu       sync.Mutex
+	config   BreakerConfig
+	breakers map[string]*circuitBreaker
+}
+
+func newBreakerGroup(config *BreakerConfig) *breakerGroup {
+	if config == nil {
+		return nil
+	}
+	return &breakerGroup{config: config.withDefault(), breakers: make(map[string]*circuitBreaker)}
+}
+
+// allow check whether a request to the host can be sent, every allowed request must be reported
+func (g *breakerGroup) allow(host string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[host]
+	if !ok {
+		b = &circuitBreaker{}
+		g.breakers[host] = b
+	}
+
+	if b.state == BreakerOpen {
+		retryAt := b.openedAt.Add(g.config.OpenTimeout)
+		if time.Now().Before(retryAt) {
+			return &CircuitOpenError{Host: host, RetryAt: retryAt}
+		}
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	if b.state == BreakerHalfOpen {
+		if b.probes >= g.config.HalfOpenProbes {
+			return &CircuitOpenError{Host: host, RetryAt: time.Now().Add(g.config.OpenTimeout)}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// report record the result of an allowed request, the network errors and 5xx are failures
+func (g *breakerGroup) report(host string, resp *http.Response, err error) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	b, ok := g.breakers[host]
+	if !ok {
+		return
+	}
+
+	canceled := errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+	failed := (resp == nil && err != nil && !canceled) || (resp != nil && resp.StatusCode >= 500)
+	if b.state == BreakerHalfOpen {
+		b.probes--
+		if canceled {
+			return
+		}
+	}
+	if !failed {
+		if !canceled {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= g.config.FailureThreshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (g *breakerGroup) states() map[string]BreakerState {
+	states := make(map[string]BreakerState)
+	if g == nil {
+		return states
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for host, b := range g.breakers {
+		state := b.state
+		if state == BreakerOpen && !time.Now().Before(b.openedAt.Add(g.config.OpenTimeout)) {
+			state = BreakerHalfOpen
+		}
+		states[host] = state
+	}
+	return states
+}
+
+// CircuitBreakerStates return the breaker state of every host the client has requested,
+// it is empty if the circuit breaker is not enabled by WithCircuitBreaker
+func (p *PixivClient) CircuitBreakerStates() map[string]BreakerState {
+	return p.breakers.states()
+}
@@ -0,0 +1,56 @@
+package pixiv_api_go
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var count, healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond}),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetUserIllusts("1"); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("unexpected circuit open at %d", i)
+		}
+	}
+
+	_, err := client.GetUserIllusts("1")
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Host != serverUrl.Host {
+		t.Errorf("expected circuit open error, acture: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 requests, acture: %d", count)
+	}
+	if state := client.CircuitBreakerStates()[serverUrl.Host]; state != BreakerOpen {
+		t.Errorf("expected: %s, acture: %s", BreakerOpen, state)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if state := client.CircuitBreakerStates()[serverUrl.Host]; state != BreakerClosed {
+		t.Errorf("expected: %s, acture: %s", BreakerClosed, state)
+	}
+}
@@ -0,0 +1,195 @@
+package pixiv_api_go
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache store the raw responses of the metadata endpoints, the implementations must be
+// safe for concurrent use. See NewLRUCache and NewDiskCache.
+type Cache interface {
+	// Get return the value of the key, ok is false if the key is missing or expired
+	Get(key string) (value []byte, ok bool)
+	// Set store the value with the ttl, the value must not be modified after Set
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// DefaultCacheTTL is the per endpoint ttl used by WithCache if nil ttl is given,
+// the endpoints not in the map are never cached
+var DefaultCacheTTL = map[string]time.Duration{
+	EndpointIllustInfo:    time.Hour,
+	EndpointIllustPages:   time.Hour,
+	EndpointUserIllusts:   10 * time.Minute,
+	EndpointUserFollowing: 10 * time.Minute,
+}
+
+// cacheKey is endpoint + url + the session from the pool + a fingerprint of the sent PHPSESSID, the
+// response of the same url may be different for different sessions, e.g. bookmarkData
+func (p *PixivClient) cacheKey(ctx context.Context, endpoint, url string, s *pooledSession) string {
+	session := ""
+	if sid := p.sentSessionId(ctx, url, s); len(sid) > 0 {
+		sum := sha1.Sum([]byte(sid))
+		session = hex.EncodeToString(sum[:8])
+	}
+	return endpoint + " " + url + " " + sessionName(s) + " " + session
+}
+
+// cacheTTL return the ttl of the endpoint, zero means the endpoint is not cached
+func (p *PixivClient) cacheTTL(endpoint string) time.Duration {
+	if p.cache == nil {
+		return 0
+	}
+	return p.cacheTTLs[endpoint]
+}
+
+// LRUCache is a bounded in-memory Cache which evict the least recently used entries
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time
+}
+
+// NewLRUCache create a LRUCache holding at most maxEntries entries
+func NewLRUCache(maxEntries int) *LRUCache {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &LRUCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expireAt) {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expireAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value = value
+		entry.expireAt = expireAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expireAt: expireAt})
+	for c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Len return the number of entries, including the expired ones not evicted yet
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// DiskCache is a Cache storing every entry in a file under the dir, so the cached
+// responses survive across the runs of a batch job
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache create a DiskCache in dir, the dir is created if not exists
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := CheckAndMkdir(dir); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// Get read the entry file, the file starts with the 8 bytes expire time in unix nano
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil || len(data) < 8 {
+		return nil, false
+	}
+	expireAt := time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))
+	if time.Now().After(expireAt) {
+		_ = os.Remove(c.path(key))
+		return nil, false
+	}
+	return data[8:], true
+}
+
+// Set write the entry to a temp file then rename it, so that a concurrent Get never
+// reads a partial entry. The errors are ignored as the entry is only a cache.
+func (c *DiskCache) Set(key string, value []byte, ttl time.Duration) {
+	filename := c.path(key)
+	if err := CheckAndMkdir(filepath.Dir(filename)); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return
+	}
+	var header [8]byte
+	binary.BigEndian.PutUint64(header[:], uint64(time.Now().Add(ttl).UnixNano()))
+	_, err1 := tmp.Write(header[:])
+	_, err2 := tmp.Write(value)
+	err3 := tmp.Close()
+	if err1 != nil || err2 != nil || err3 != nil || os.Rename(tmp.Name(), filename) != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+
+// Prune remove all the expired entries
+func (c *DiskCache) Prune() error {
+	return filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil
+		}
+		var header [8]byte
+		_, err = f.Read(header[:])
+		_ = f.Close()
+		if err != nil || time.Now().After(time.Unix(0, int64(binary.BigEndian.Uint64(header[:])))) {
+			_ = os.Remove(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package pixiv_api_go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	cache := NewLRUCache(2)
+	cache.Set("a", []byte("1"), time.Hour)
+	cache.Set("b", []byte("2"), time.Hour)
+	_, _ = cache.Get("a")
+	cache.Set("c", []byte("3"), time.Hour)
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected b evicted")
+	}
+	if v, ok := cache.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("expected a: 1, acture: %s, %v", v, ok)
+	}
+
+	cache.Set("d", []byte("4"), -time.Second)
+	if _, ok := cache.Get("d"); ok {
+		t.Errorf("expected d expired")
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	cache, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set("a", []byte("1"), time.Hour)
+	cache.Set("b", []byte("2"), -time.Second)
+	if v, ok := cache.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("expected a: 1, acture: %s, %v", v, ok)
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected b expired")
+	}
+	if err := cache.Prune(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"1":null,"2":null}}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithCache(NewLRUCache(16), nil))
+	for i := 0; i < 3; i++ {
+		illusts, err := client.GetUserIllusts("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(illusts) != 2 {
+			t.Errorf("expected 2 illusts, acture: %v", illusts)
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected 1 request, acture: %d", count)
+	}
+
+	client.SetCookiePHPSESSID("other")
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected the cache not shared by sessions, requests: %d", count)
+	}
+}
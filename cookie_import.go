@@ -0,0 +1,221 @@
+package pixiv_api_go
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseNetscapeCookies parse the Netscape/Mozilla cookies.txt format, e.g. exported by curl,
+// yt-dlp or the browser extensions. Every line has 7 tab separated fields:
+//
+//	domain  include_subdomains  path  secure  expires  name  value
+func ParseNetscapeCookies(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if len(strings.TrimSpace(line)) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			// the value is empty
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("invalid cookies.txt line %d: expected 7 fields, got %d", lineNo, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookies.txt line %d: %w", lineNo, err)
+		}
+
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cookies, nil
+}
+
+// jsonCookie is the cookie exported by the browser extensions, e.g. EditThisCookie,
+// Cookie-Editor (expirationDate) and puppeteer/playwright (expires)
+type jsonCookie struct {
+	Domain         string          `json:"domain"`
+	Name           string          `json:"name"`
+	Value          string          `json:"value"`
+	Path           string          `json:"path"`
+	Secure         bool            `json:"secure"`
+	HttpOnly       bool            `json:"httpOnly"`
+	Session        bool            `json:"session"`
+	ExpirationDate float64         `json:"expirationDate"`
+	Expires        json.RawMessage `json:"expires"`
+}
+
+func (c *jsonCookie) expireTime() time.Time {
+	if c.Session {
+		return time.Time{}
+	}
+	if c.ExpirationDate > 0 {
+		sec, frac := math.Modf(c.ExpirationDate)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+	if len(c.Expires) == 0 {
+		return time.Time{}
+	}
+	var num float64
+	if err := json.Unmarshal(c.Expires, &num); err == nil {
+		if num <= 0 {
+			return time.Time{}
+		}
+		sec, frac := math.Modf(num)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+	var str string
+	if err := json.Unmarshal(c.Expires, &str); err == nil {
+		for _, layout := range []string{time.RFC3339, http.TimeFormat, time.RFC1123} {
+			if t, err := time.Parse(layout, str); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// ParseJsonCookies parse the json cookies exported by the browser extensions, both a json
+// array of cookies and an object like {"cookies": [...]} are supported
+func ParseJsonCookies(r io.Reader) ([]*http.Cookie, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []jsonCookie
+	if err := json.Unmarshal(data, &list); err != nil {
+		var wrapped struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err2 := json.Unmarshal(data, &wrapped); err2 != nil {
+			return nil, NewJsonUnmarshalErr(data, err)
+		}
+		list = wrapped.Cookies
+	}
+
+	cookies := make([]*http.Cookie, 0, len(list))
+	for i := range list {
+		c := &list[i]
+		if len(c.Name) == 0 {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Name:     c.Name,
+			Value:    c.Value,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			Expires:  c.expireTime(),
+		})
+	}
+	return cookies, nil
+}
+
+// LoadCookiesFile parse the cookies file, the json format is detected by the first
+// non-space character, otherwise the file is parsed as cookies.txt
+func LoadCookiesFile(filename string) ([]*http.Cookie, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return ParseJsonCookies(bytes.NewReader(trimmed))
+	}
+	return ParseNetscapeCookies(bytes.NewReader(data))
+}
+
+// FilterPixivCookies return the unexpired cookies of the pixiv.net domains
+func FilterPixivCookies(cookies []*http.Cookie) []*http.Cookie {
+	now := time.Now()
+	var filtered []*http.Cookie
+	for _, c := range cookies {
+		if !matchDomain(c.Domain, DefaultJarDomains) {
+			continue
+		}
+		if !c.Expires.IsZero() && c.Expires.Before(now) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+	return filtered
+}
+
+// ImportCookies add the unexpired pixiv.net cookies to the client, they are also stored in
+// the cookie jar if the client has one. It returns the number of the imported cookies.
+func (p *PixivClient) ImportCookies(cookies []*http.Cookie) int {
+	cookies = FilterPixivCookies(cookies)
+	if len(cookies) == 0 {
+		return 0
+	}
+
+	p.mu.Lock()
+	cookieMap := copyMap(p.Cookie)
+	for _, c := range cookies {
+		cookieMap[c.Name] = c.Value
+	}
+	p.Cookie = cookieMap
+	web, _ := url.Parse(p.baseUrls.Web)
+	p.mu.Unlock()
+
+	if p.jar != nil {
+		if web == nil || !matchDomain(web.Hostname(), DefaultJarDomains) {
+			web, _ = url.Parse(DefaultWebBaseUrl)
+		}
+		p.jar.SetCookies(web, cookies)
+	}
+	return len(cookies)
+}
+
+// ImportCookiesFile load the cookies.txt or json cookies file and import the pixiv.net
+// cookies to the client, an error is returned if no pixiv.net cookie is found
+func (p *PixivClient) ImportCookiesFile(filename string) (int, error) {
+	cookies, err := LoadCookiesFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	n := p.ImportCookies(cookies)
+	if n == 0 {
+		return 0, errors.New("no unexpired pixiv.net cookie found in " + filename)
+	}
+	return n, nil
+}
@@ -0,0 +1,60 @@
+package pixiv_api_go
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNetscapeCookies(t *testing.T) {
+	content := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		"#HttpOnly_.pixiv.net\tTRUE\t/\tTRUE\t4102444800\tPHPSESSID\t123_abc\n" +
+		".pixiv.net\tTRUE\t/\tFALSE\t0\tp_ab_id\t5\n" +
+		".pixiv.net\tTRUE\t/\tFALSE\t1000\texpired\tx\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tother\ty\n"
+	cookies, err := ParseNetscapeCookies(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 4 || !cookies[0].HttpOnly || cookies[0].Value != "123_abc" {
+		t.Errorf("unexpected cookies: %v", cookies)
+	}
+
+	filtered := FilterPixivCookies(cookies)
+	if len(filtered) != 2 || filtered[0].Name != "PHPSESSID" || filtered[1].Name != "p_ab_id" {
+		t.Errorf("unexpected filtered cookies: %v", filtered)
+	}
+
+	if _, err := ParseNetscapeCookies(strings.NewReader("bad line\n")); err == nil {
+		t.Errorf("expected error of the bad line")
+	}
+}
+
+func TestImportCookiesFile(t *testing.T) {
+	content := `[
+  {"domain": ".pixiv.net", "name": "PHPSESSID", "value": "123_abc", "path": "/", "expirationDate": 4102444800.5, "httpOnly": true},
+  {"domain": "www.pixiv.net", "name": "session", "value": "s", "path": "/", "session": true},
+  {"domain": ".pixiv.net", "name": "expired", "value": "x", "path": "/", "expires": 1000},
+  {"domain": ".example.com", "name": "other", "value": "y", "path": "/"}
+]`
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	jar := NewPersistentJar()
+	client := NewPixivClientWithOptions(WithCookieJar(jar))
+	n, err := client.ImportCookiesFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 cookies imported, acture: %d", n)
+	}
+	cookie := client.GetCookie()
+	if cookie["PHPSESSID"] != "123_abc" || cookie["session"] != "s" || len(cookie) != 2 {
+		t.Errorf("unexpected client cookies: %v", cookie)
+	}
+}
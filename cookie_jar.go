@@ -0,0 +1,215 @@
+package pixiv_api_go
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJarDomains is the domains accepted by PersistentJar by default
+var DefaultJarDomains = []string{"pixiv.net"}
+
+// PersistentJar is a http.CookieJar only accepting the cookies of the pixiv domains, it
+// captures the Set-Cookie refreshes and can be saved to and loaded from a file, so that a
+// long-running daemon keeps a valid session across restarts.
+type PersistentJar struct {
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	domains []string
+	entries map[string]*jarEntry
+}
+
+// jarEntry is a cookie kept for saving, the cookie is replayed to SetCookies with the url when loading
+type jarEntry struct {
+	URL      string    `json:"url"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"httpOnly,omitempty"`
+}
+
+func (e *jarEntry) key() string {
+	u, _ := url.Parse(e.URL)
+	domain := e.Domain
+	if len(domain) == 0 && u != nil {
+		domain = u.Hostname()
+	}
+	return strings.TrimPrefix(domain, ".") + ";" + e.Path + ";" + e.Name
+}
+
+func (e *jarEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && e.Expires.Before(now)
+}
+
+func (e *jarEntry) cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Domain:   e.Domain,
+		Path:     e.Path,
+		Expires:  e.Expires,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+	}
+}
+
+// NewPersistentJar create a jar accepting the cookies of the domains and their sub domains,
+// DefaultJarDomains is used if no domain is given
+func NewPersistentJar(domains ...string) *PersistentJar {
+	if len(domains) == 0 {
+		domains = DefaultJarDomains
+	}
+	jar, _ := cookiejar.New(nil)
+	return &PersistentJar{
+		jar:     jar,
+		domains: append([]string(nil), domains...),
+		entries: make(map[string]*jarEntry),
+	}
+}
+
+// LoadPersistentJar create a jar and load the cookies from the file saved by Save,
+// an empty jar is returned if the file does not exist
+func LoadPersistentJar(filename string, domains ...string) (*PersistentJar, error) {
+	jar := NewPersistentJar(domains...)
+	if err := jar.Load(filename); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return jar, nil
+}
+
+func (j *PersistentJar) allowed(u *url.URL) bool {
+	return matchDomain(u.Hostname(), j.domains)
+}
+
+// matchDomain reports whether host is one of the domains or their sub domains
+func matchDomain(host string, domains []string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), ".")
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *PersistentJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if !j.allowed(u) || len(cookies) == 0 {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	origin := (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	for _, c := range cookies {
+		entry := &jarEntry{
+			URL:      origin,
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  c.Expires,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+		}
+		if c.MaxAge > 0 {
+			entry.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		if c.MaxAge < 0 || entry.expired(now) {
+			delete(j.entries, entry.key())
+			continue
+		}
+		j.entries[entry.key()] = entry
+	}
+}
+
+func (j *PersistentJar) Cookies(u *url.URL) []*http.Cookie {
+	if !j.allowed(u) {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// Save write the unexpired cookies to the file in json, the file is only readable by the owner
+func (j *PersistentJar) Save(filename string) error {
+	j.mu.Lock()
+	now := time.Now()
+	entries := make([]*jarEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+	j.mu.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data, 0600)
+}
+
+// Load read the cookies saved by Save into the jar, the expired ones are dropped
+func (j *PersistentJar) Load(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var entries []*jarEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return NewJsonUnmarshalErr(data, err)
+	}
+	now := time.Now()
+	for _, e := range entries {
+		u, err := url.Parse(e.URL)
+		if err != nil || e.expired(now) {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{e.cookie()})
+	}
+	return nil
+}
+
+// writeFileAtomic write the data to a temp file then rename it to filename
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	if err := CheckAndMkdir(filepath.Dir(filename)); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// CookieJar return the cookie jar set by WithCookieJar, nil if it is not set
+func (p *PixivClient) CookieJar() http.CookieJar {
+	return p.jar
+}
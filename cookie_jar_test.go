@@ -0,0 +1,90 @@
+package pixiv_api_go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistentJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		if c == nil {
+			t.Errorf("no session cookie")
+		} else if c.Value == "old" {
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "new", Path: "/", MaxAge: 3600})
+		} else if c.Value != "new" {
+			t.Errorf("unexpected session cookie: %s", c.Value)
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "cookies.json")
+	jar := NewPersistentJar("127.0.0.1")
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithCookiePHPSESSID("old"),
+		WithCookieJar(jar),
+		WithRequestCoalescing(false),
+	)
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetUserIllusts("1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := jar.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadPersistentJar(filename, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(server.URL)
+	cookies := loaded.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Value != "new" {
+		t.Errorf("unexpected loaded cookies: %v", cookies)
+	}
+
+	other, _ := url.Parse("https://example.com/")
+	loaded.SetCookies(other, []*http.Cookie{{Name: "a", Value: "b"}})
+	if cookies := loaded.Cookies(other); len(cookies) != 0 {
+		t.Errorf("expected the cookies of other domains ignored, acture: %v", cookies)
+	}
+}
+
+func TestCookieJarCache(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "refreshed", Path: "/"})
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"` + c.Value + `":null}}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithCookiePHPSESSID("session"),
+		WithCookieJar(NewPersistentJar("127.0.0.1")),
+		WithCache(NewLRUCache(10), nil),
+	)
+	get := func(expected PixivID) {
+		illusts, err := client.GetUserIllusts("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(illusts) != 1 || illusts[0] != expected {
+			t.Errorf("expected %s, acture: %v", expected, illusts)
+		}
+	}
+	get("session")
+	if err := client.GetAjax("/login", nil, "/", nil); err != nil {
+		t.Fatal(err)
+	}
+	// the response cached for the old PHPSESSID is not returned to the refreshed one
+	get("refreshed")
+}
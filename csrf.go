@@ -0,0 +1,174 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+)
+
+// csrfTokenRegexp find the token in the meta global-data or the next data of the www.pixiv.net page
+var csrfTokenRegexp = regexp.MustCompile(`"token":"([0-9a-zA-Z]+)"`)
+
+// csrfCache cache the x-csrf-token of every session, the zero value is ready to use
+type csrfCache struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (c *csrfCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[key]
+	return token, ok
+}
+
+func (c *csrfCache) set(key, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	c.tokens[key] = token
+}
+
+// csrfKey identify the session the token belongs to, the name of the session from the pool
+// or a fingerprint of the PHPSESSID sent to the www.pixiv.net page
+func (p *PixivClient) csrfKey(ctx context.Context, s *pooledSession) string {
+	if s != nil {
+		return "session " + s.Name
+	}
+	sum := sha1.Sum([]byte(p.sentSessionId(ctx, p.BaseUrls().Web+"/", nil)))
+	return "sid " + hex.EncodeToString(sum[:8])
+}
+
+// csrfToken return the cached token of the session, or fetch it from the www.pixiv.net page
+// if there is none or refresh is true. ErrLoginRequired is returned if the page has no token.
+func (p *PixivClient) csrfToken(ctx context.Context, key string, refresh bool) (string, error) {
+	if !refresh {
+		if token, ok := p.csrf.get(key); ok {
+			return token, nil
+		}
+	}
+	pageUrl := p.BaseUrls().Web + "/"
+	body, err := p.readRawDate(ctx, EndpointCsrfToken, pageUrl, pageUrl)
+	if err != nil {
+		return "", err
+	}
+	match := csrfTokenRegexp.FindSubmatch(body)
+	if match == nil {
+		return "", ErrLoginRequired
+	}
+	token := string(match[1])
+	p.csrf.set(key, token)
+	return token, nil
+}
+
+// PostAjaxForm send the form to the ajax api path of the Web base url with the x-csrf-token,
+// e.g. "/ajax/illusts/bookmarks/delete", refer is the path of the Referer. It returns the
+// body of the pixiv response.
+func (p *PixivClient) PostAjaxForm(path string, form url.Values, refer string) (json.RawMessage, error) {
+	return p.PostAjaxFormWithContext(context.Background(), path, form, refer)
+}
+
+// PostAjaxFormWithContext is like PostAjaxForm but with a context
+func (p *PixivClient) PostAjaxFormWithContext(ctx context.Context, path string, form url.Values, refer string) (json.RawMessage, error) {
+	return p.postAjax(ctx, path, refer, "application/x-www-form-urlencoded; charset=utf-8", []byte(form.Encode()))
+}
+
+// PostAjaxJson is like PostAjaxForm but send the body encoded as json,
+// e.g. "/ajax/illusts/bookmarks/add"
+func (p *PixivClient) PostAjaxJson(path string, body any, refer string) (json.RawMessage, error) {
+	return p.PostAjaxJsonWithContext(context.Background(), path, body, refer)
+}
+
+// PostAjaxJsonWithContext is like PostAjaxJson but with a context
+func (p *PixivClient) PostAjaxJsonWithContext(ctx context.Context, path string, body any, refer string) (json.RawMessage, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return p.postAjax(ctx, path, refer, "application/json; charset=utf-8", data)
+}
+
+// postAjax send the post request by the write session, the csrf token is fetched again and
+// the request is sent once more if pixiv rejects it with 400 or 403
+func (p *PixivClient) postAjax(ctx context.Context, path, refer, contentType string, body []byte) (json.RawMessage, error) {
+	// the token and the post must be sent by the same session
+	session, err := p.pickSession(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		ctx = ContextWithSession(ctx, session.Name)
+	}
+	key := p.csrfKey(ctx, session)
+	token, err := p.csrfToken(ctx, key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the result is reported to the session once the response is parsed, the post rejected
+	// for the stale token is not a failure of the session unless it is rejected again
+	postCtx, holder := withPickedSessionHolder(ctx)
+	holder.deferErrors = true
+	baseUrls := p.BaseUrls()
+	urlStr := baseUrls.Web + ajaxPath(path)
+	referUrl := baseUrls.Web + ajaxPath(refer)
+	respBody, err := p.postWithToken(postCtx, urlStr, referUrl, contentType, body, token)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusBadRequest || httpErr.StatusCode == http.StatusForbidden) {
+		if token, err = p.csrfToken(ctx, key, true); err != nil {
+			return nil, err
+		}
+		respBody, err = p.postWithToken(postCtx, urlStr, referUrl, contentType, body, token)
+	}
+	if err != nil {
+		p.sessions.report(session, err)
+		return nil, err
+	}
+
+	var pResp PixivResponse
+	if err := json.Unmarshal(respBody, &pResp); err != nil {
+		p.sessions.report(session, nil)
+		return nil, NewJsonUnmarshalErr(respBody, err)
+	}
+	if pResp.Error {
+		apiErr := &PixivAPIError{Message: pResp.Message, URL: urlStr}
+		if errors.Is(apiErr, ErrLoginRequired) {
+			p.sessions.report(session, apiErr)
+		} else {
+			p.sessions.report(session, nil)
+		}
+		return nil, apiErr
+	}
+	p.sessions.report(session, nil)
+	return pResp.Body, nil
+}
+
+func (p *PixivClient) postWithToken(ctx context.Context, urlStr, refer, contentType string, body []byte, token string) ([]byte, error) {
+	header := map[string]string{
+		"Content-Type": contentType,
+		"Accept":       "application/json",
+		"Origin":       p.BaseUrls().Web,
+		"X-Csrf-Token": token,
+	}
+	resp, err := p.send(ctx, EndpointAjaxPost, "POST", urlStr, refer, header, body)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return data, err
+}
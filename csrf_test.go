@@ -0,0 +1,104 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPostAjax(t *testing.T) {
+	var tokenVersion, pageFetches int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&pageFetches, 1)
+		cookie, _ := r.Cookie("PHPSESSID")
+		_, _ = fmt.Fprintf(w, `<meta name="global-data" id="meta-global-data" content='{"token":"%s%d","services":{}}'>`,
+			cookie.Value, atomic.LoadInt32(&tokenVersion))
+	})
+	mux.HandleFunc("/ajax/illusts/bookmarks/add", func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("PHPSESSID")
+		if r.Method != "POST" || cookie.Value != "writer" || r.Header.Get("Referer") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Csrf-Token") != fmt.Sprintf("writer%d", atomic.LoadInt32(&tokenVersion)) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":true,"message":"invalid token","body":[]}`))
+			return
+		}
+		var req struct {
+			IllustId string `json:"illust_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		_, _ = fmt.Fprintf(w, `{"error":false,"message":"","body":{"last_bookmark_id":"%s"}}`, req.IllustId)
+	})
+	mux.HandleFunc("/ajax/illusts/bookmarks/delete", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(data))
+		_, _ = fmt.Fprintf(w, `{"error":true,"message":"bookmark %s not found","body":[]}`, form.Get("bookmark_id"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	pool := NewSessionPool(
+		Session{Name: "reader", Cookie: map[string]string{"PHPSESSID": "reader"}},
+		Session{Name: "writer", Cookie: map[string]string{"PHPSESSID": "writer"}},
+	)
+	pool.SetWriteSession("writer")
+	client := NewPixivClientWithOptions(WithSessionPool(pool), WithBaseUrls(BaseUrls{Web: server.URL}))
+
+	add := map[string]any{"illust_id": "102050100", "restrict": 0, "comment": "", "tags": []string{}}
+	for i := 0; i < 2; i++ {
+		body, err := client.PostAjaxJson("/ajax/illusts/bookmarks/add", add, "/artworks/102050100")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != `{"last_bookmark_id":"102050100"}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+	}
+	if pageFetches != 1 {
+		t.Errorf("expected the token fetched once, acture: %d", pageFetches)
+	}
+
+	// the expired token is refreshed
+	atomic.AddInt32(&tokenVersion, 1)
+	if _, err := client.PostAjaxJson("/ajax/illusts/bookmarks/add", add, "/artworks/102050100"); err != nil {
+		t.Fatal(err)
+	}
+	if pageFetches != 2 {
+		t.Errorf("expected the token fetched twice, acture: %d", pageFetches)
+	}
+
+	_, err := client.PostAjaxForm("ajax/illusts/bookmarks/delete", url.Values{"bookmark_id": {"1"}}, "/")
+	if apiErr, ok := err.(*PixivAPIError); !ok || apiErr.Message != "bookmark 1 not found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the post rejected again with the refreshed token is a failure
+	ctx := ContextWithSession(context.Background(), "reader")
+	if _, err := client.PostAjaxJsonWithContext(ctx, "/ajax/illusts/bookmarks/add", add, "/artworks/102050100"); err == nil {
+		t.Error("expected the post of reader rejected")
+	}
+
+	// writer: 2 page fetches and 4 posts, the one rejected for the expired token is not
+	// counted, reader: 2 page fetches and the rejected post
+	for _, h := range pool.Health() {
+		if h.Name == "writer" && (h.Requests != 6 || h.Failures != 0) {
+			t.Errorf("unexpected health: %+v", h)
+		}
+		if h.Name == "reader" && (h.Requests != 3 || h.Failures != 1) {
+			t.Errorf("unexpected health: %+v", h)
+		}
+	}
+}
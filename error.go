@@ -3,22 +3,117 @@ package pixiv_api_go
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
+// The sentinel errors can be checked by errors.Is, e.g. errors.Is(err, ErrNotFound)
 var (
 	// ErrNotFound means the api return 404
 	ErrNotFound = errors.New("NotFound")
+	// ErrUnauthorized means the api return 401
+	ErrUnauthorized = errors.New("Unauthorized")
+	// ErrForbidden means the api return 403
+	ErrForbidden = errors.New("Forbidden")
+	// ErrRateLimited means the api return 429
+	ErrRateLimited = errors.New("RateLimited")
+	// ErrLoginRequired means the request needs a valid session (PHPSESSID) but the client has not logged in
+	ErrLoginRequired = errors.New("LoginRequired")
+	// ErrNoSessionAvailable means all the sessions of the pool are cooling down
+	ErrNoSessionAvailable = errors.New("NoSessionAvailable")
+	// ErrNoProxyAvailable means all the proxies of the pool are unhealthy
+	ErrNoProxyAvailable = errors.New("NoProxyAvailable")
+	// ErrCircuitOpen means the request is not sent as the circuit breaker of the host is open
+	ErrCircuitOpen = errors.New("CircuitOpen")
 )
 
+// maxErrorBodyLen is the max length of the response body kept in the errors
+const maxErrorBodyLen = 512
+
+// HTTPError is returned when the api return a non 200 status code
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	URL        string
+	// Body is the beginning of the response body, at most maxErrorBodyLen bytes
+	Body string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("code: %d, message: %s, url: %s", e.StatusCode, e.Status, e.URL)
+}
+
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized, ErrLoginRequired:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// loginRequiredMessages is the messages pixiv return when the api needs login
+var loginRequiredMessages = []string{
+	"login",
+	"ログイン",
+	"登录",
+	"登入",
+	"로그인",
+}
+
+// PixivAPIError is returned when the api response with {"error": true, "message": "..."}
+type PixivAPIError struct {
+	Message string
+	URL     string
+}
+
+func (e *PixivAPIError) Error() string {
+	return fmt.Sprintf("Pixiv response error: %s", e.Message)
+}
+
+func (e *PixivAPIError) Is(target error) bool {
+	if target != ErrLoginRequired {
+		return false
+	}
+	msg := strings.ToLower(e.Message)
+	for _, m := range loginRequiredMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxJsonErrorRawLen is the max length of the raw json kept in ErrorJsonUnmarshal
+const maxJsonErrorRawLen = 1024
+
 type ErrorJsonUnmarshal struct {
 	err    error
 	rawStr string
+	rawLen int
 }
 
+// NewJsonUnmarshalErr create an ErrorJsonUnmarshal, only the first maxJsonErrorRawLen bytes of date are kept
 func NewJsonUnmarshalErr(date []byte, err error) error {
-	return &ErrorJsonUnmarshal{err: err, rawStr: string(date)}
+	raw := date
+	if len(raw) > maxJsonErrorRawLen {
+		raw = raw[:maxJsonErrorRawLen]
+	}
+	return &ErrorJsonUnmarshal{err: err, rawStr: string(raw), rawLen: len(date)}
 }
 
 func (j *ErrorJsonUnmarshal) Error() string {
+	if j.rawLen > len(j.rawStr) {
+		return fmt.Sprintf("failed to unmarshal json, err: %s, raw: %s...(truncated, %d bytes)", j.err, j.rawStr, j.rawLen)
+	}
 	return fmt.Sprintf("failed to unmarshal json, err: %s, raw: %s", j.err, j.rawStr)
 }
+
+func (j *ErrorJsonUnmarshal) Unwrap() error {
+	return j.err
+}
@@ -0,0 +1,417 @@
+package pixiv_api_go
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fakeRankPageSize is the page size of the rank, the same as pixiv
+const fakeRankPageSize = 50
+
+type fakeRankKey struct {
+	mode    IllustRankMode
+	content IllustRankContent
+}
+
+// FakePixivAPI is an in-memory PixivAPI seeded with fixtures, for the tests of the consumers.
+// The unknown illusts and images get ErrNotFound. It is safe for concurrent use.
+type FakePixivAPI struct {
+	mu sync.RWMutex
+	// illusts is the pages of every illust
+	illusts   map[PixivID][]*IllustInfo
+	users     map[PixivID]*UserProfile
+	bookmarks map[PixivID][]PixivID
+	following map[PixivID][]PixivID
+	// ranks is the illust ids of every date, keyed by mode and content
+	ranks  map[fakeRankKey]map[string][]PixivID
+	images map[string][]byte
+}
+
+func NewFakePixivAPI() *FakePixivAPI {
+	return &FakePixivAPI{
+		illusts:   make(map[PixivID][]*IllustInfo),
+		users:     make(map[PixivID]*UserProfile),
+		bookmarks: make(map[PixivID][]PixivID),
+		following: make(map[PixivID][]PixivID),
+		ranks:     make(map[fakeRankKey]map[string][]PixivID),
+		images:    make(map[string][]byte),
+	}
+}
+
+// AddIllust add the pages of one or more illusts, the page with the same PageIdx is replaced,
+// the pages are ordered by PageIdx and the author is added as a user
+func (f *FakePixivAPI) AddIllust(pages ...*IllustInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	touched := make(map[PixivID]struct{})
+	for _, page := range pages {
+		illust := *page
+		touched[illust.Id] = struct{}{}
+		f.illusts[illust.Id] = replacePage(f.illusts[illust.Id], &illust)
+		if u, ok := f.users[illust.UserId]; !ok {
+			f.users[illust.UserId] = &UserProfile{UserInfo: illust.UserInfo}
+		} else if len(u.UserName) == 0 {
+			u.UserInfo = illust.UserInfo
+		}
+	}
+	for id := range touched {
+		illustPages := f.illusts[id]
+		sort.SliceStable(illustPages, func(i, j int) bool {
+			return illustPages[i].PageIdx < illustPages[j].PageIdx
+		})
+	}
+}
+
+// replacePage replace the page with the same PageIdx, or append it if there is none
+func replacePage(pages []*IllustInfo, page *IllustInfo) []*IllustInfo {
+	for i, p := range pages {
+		if p.PageIdx == page.PageIdx {
+			pages[i] = page
+			return pages
+		}
+	}
+	return append(pages, page)
+}
+
+// AddUser add or replace a user
+func (f *FakePixivAPI) AddUser(user *UserInfo) {
+	f.AddUserProfile(&UserProfile{UserInfo: *user})
+}
+
+// AddUserProfile add or replace a user with the full profile
+func (f *FakePixivAPI) AddUserProfile(profile *UserProfile) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[profile.UserId] = copyUserProfile(profile)
+}
+
+// AddBookmark add the illusts to the bookmarks of the user, the latest bookmark comes first
+func (f *FakePixivAPI) AddBookmark(uid PixivID, illustIds ...PixivID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ensureUser(uid)
+	for _, id := range illustIds {
+		f.bookmarks[uid] = append([]PixivID{id}, f.bookmarks[uid]...)
+	}
+}
+
+// AddFollowing add the users to the following of the user
+func (f *FakePixivAPI) AddFollowing(uid PixivID, userIds ...PixivID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ensureUser(uid)
+	f.following[uid] = append(f.following[uid], userIds...)
+}
+
+// ensureUser add a user with only the id if it is unknown, the lock must be held
+func (f *FakePixivAPI) ensureUser(uid PixivID) {
+	if _, ok := f.users[uid]; !ok {
+		f.users[uid] = &UserProfile{UserInfo: UserInfo{UserId: uid}}
+	}
+}
+
+// SetRank set the rank of the date in order, date format: 20230118
+func (f *FakePixivAPI) SetRank(mode IllustRankMode, content IllustRankContent, date string, illustIds ...PixivID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeRankKey{mode: mode, content: content}
+	if f.ranks[key] == nil {
+		f.ranks[key] = make(map[string][]PixivID)
+	}
+	f.ranks[key][date] = append([]PixivID(nil), illustIds...)
+}
+
+// AddImage add the image data returned for the url
+func (f *FakePixivAPI) AddImage(url string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[url] = append([]byte(nil), data...)
+}
+
+func (f *FakePixivAPI) GetIllustInfo(illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
+	return f.GetIllustInfoWithContext(context.Background(), illustId, onlyP0)
+}
+
+func (f *FakePixivAPI) GetIllustInfoWithContext(ctx context.Context, illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	pages, ok := f.illusts[illustId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if onlyP0 {
+		pages = pages[:1]
+	}
+	illusts := make([]*IllustInfo, 0, len(pages))
+	for _, page := range pages {
+		illust := *page
+		illusts = append(illusts, &illust)
+	}
+	return illusts, nil
+}
+
+func (f *FakePixivAPI) GetUserInfo(uid string, full bool) (*UserInfo, error) {
+	return f.GetUserInfoWithContext(context.Background(), uid, full)
+}
+
+func (f *FakePixivAPI) GetUserInfoWithContext(ctx context.Context, uid string, full bool) (*UserInfo, error) {
+	profile, err := f.GetUserProfileWithContext(ctx, uid, full)
+	if err != nil {
+		return nil, err
+	}
+	return &profile.UserInfo, nil
+}
+
+func (f *FakePixivAPI) GetUserProfile(uid string, full bool) (*UserProfile, error) {
+	return f.GetUserProfileWithContext(context.Background(), uid, full)
+}
+
+// GetUserProfileWithContext return a copy of the profile, the fields only filled in the full
+// mode are cleared if full is false
+func (f *FakePixivAPI) GetUserProfileWithContext(ctx context.Context, uid string, full bool) (*UserProfile, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	user, ok := f.users[PixivID(uid)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !full {
+		return &UserProfile{
+			UserInfo:   user.UserInfo,
+			Image:      user.Image,
+			ImageBig:   user.ImageBig,
+			Premium:    user.Premium,
+			IsFollowed: user.IsFollowed,
+		}, nil
+	}
+	return copyUserProfile(user), nil
+}
+
+func (f *FakePixivAPI) GetUserIllusts(uid string) ([]PixivID, error) {
+	return f.GetUserIllustsWithContext(context.Background(), uid)
+}
+
+func (f *FakePixivAPI) GetUserIllustsWithContext(ctx context.Context, uid string) ([]PixivID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, ok := f.users[PixivID(uid)]; !ok {
+		return nil, ErrNotFound
+	}
+	illusts := make([]PixivID, 0)
+	for id, pages := range f.illusts {
+		if pages[0].UserId == PixivID(uid) {
+			illusts = append(illusts, id)
+		}
+	}
+	// the newest first, a longer id is always newer
+	sort.Slice(illusts, func(i, j int) bool {
+		if len(illusts[i]) != len(illusts[j]) {
+			return len(illusts[i]) > len(illusts[j])
+		}
+		return illusts[i] > illusts[j]
+	})
+	return illusts, nil
+}
+
+func (f *FakePixivAPI) GetUserBookmarks(uid string, offset, limit int32) (*BookmarksInfo, error) {
+	return f.GetUserBookmarksWithContext(context.Background(), uid, offset, limit)
+}
+
+func (f *FakePixivAPI) GetUserBookmarksWithContext(ctx context.Context, uid string, offset, limit int32) (*BookmarksInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, ok := f.users[PixivID(uid)]; !ok {
+		return nil, ErrNotFound
+	}
+	ids := f.bookmarks[PixivID(uid)]
+	bookmarks := &BookmarksInfo{Total: int32(len(ids)), Works: make([]*IllustDigest, 0)}
+	for _, id := range fakePage(ids, offset, limit) {
+		digest := &IllustDigest{Id: id, BookmarkDate: &BookmarkDate{Id: id}}
+		if pages, ok := f.illusts[id]; ok {
+			digest.Title = pages[0].Title
+			digest.PageCount = int32(pages[0].PageCount)
+			digest.UserInfo = pages[0].UserInfo
+		}
+		bookmarks.Works = append(bookmarks.Works, digest)
+	}
+	return bookmarks, nil
+}
+
+func (f *FakePixivAPI) GetUserFollowing(uid string, offset, limit int32) (*FollowingInfo, error) {
+	return f.GetUserFollowingWithContext(context.Background(), uid, offset, limit)
+}
+
+func (f *FakePixivAPI) GetUserFollowingWithContext(ctx context.Context, uid string, offset, limit int32) (*FollowingInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if _, ok := f.users[PixivID(uid)]; !ok {
+		return nil, ErrNotFound
+	}
+	ids := f.following[PixivID(uid)]
+	following := &FollowingInfo{Total: int32(len(ids)), Users: make([]*UserInfo, 0)}
+	for _, id := range fakePage(ids, offset, limit) {
+		user := UserInfo{UserId: id}
+		if u, ok := f.users[id]; ok {
+			user = u.UserInfo
+		}
+		following.Users = append(following.Users, &user)
+	}
+	return following, nil
+}
+
+func (f *FakePixivAPI) IllustRank(mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error) {
+	return f.IllustRankWithContext(context.Background(), mode, content, date, page)
+}
+
+// IllustRankWithContext return the rank set by SetRank, the latest date is used if date is empty
+func (f *FakePixivAPI) IllustRankWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	dates := f.ranks[fakeRankKey{mode: mode, content: content}]
+	latest := ""
+	for d := range dates {
+		if d > latest {
+			latest = d
+		}
+	}
+	if len(date) == 0 {
+		date = latest
+	}
+	ids, ok := dates[date]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * fakeRankPageSize
+	if offset >= len(ids) && offset > 0 {
+		return nil, ErrNotFound
+	}
+
+	rank := &IllustRankInfo{
+		Mode:      mode,
+		Content:   content,
+		Page:      RankPageType(page),
+		Prev:      RankPageType(page - 1),
+		Date:      RankDateType(date),
+		NextDate:  "false",
+		RankTotal: len(ids),
+		Contents:  make([]*IllustRankItem, 0),
+	}
+	if offset+fakeRankPageSize < len(ids) {
+		rank.Next = RankPageType(page + 1)
+	}
+	if day, err := time.Parse("20060102", date); err == nil {
+		rank.PrevDate = RankDateType(day.AddDate(0, 0, -1).Format("20060102"))
+		if date != latest {
+			rank.NextDate = RankDateType(day.AddDate(0, 0, 1).Format("20060102"))
+		}
+	}
+	for idx, id := range fakePage(ids, int32(offset), fakeRankPageSize) {
+		item := &IllustRankItem{IllustId: id, Rank: offset + idx + 1}
+		if pages, ok := f.illusts[id]; ok {
+			illust := pages[0]
+			item.Title = illust.Title
+			item.Tags = illust.Tags
+			item.Url = illust.Urls.Small
+			item.IllustType = strconv.Itoa(int(illust.IllustType))
+			item.IllustPageCount = strconv.Itoa(illust.PageCount)
+			item.UserId = illust.UserId
+			item.UserName = illust.UserName
+			item.Width = illust.Width
+			item.Height = illust.Height
+			item.ViewCount = illust.ViewCount
+			item.IllustUploadTimestamp = int(illust.UploadDate.Unix())
+		}
+		rank.Contents = append(rank.Contents, item)
+	}
+	return rank, nil
+}
+
+func (f *FakePixivAPI) GetIllust(url string) (io.ReadCloser, error) {
+	return f.GetIllustWithContext(context.Background(), url)
+}
+
+func (f *FakePixivAPI) GetIllustWithContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	data, err := f.GetIllustDataWithContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &contextReadCloser{ctx: ctx, rc: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *FakePixivAPI) GetIllustData(url string) ([]byte, error) {
+	return f.GetIllustDataWithContext(context.Background(), url)
+}
+
+func (f *FakePixivAPI) GetIllustDataWithContext(ctx context.Context, url string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	data, ok := f.images[url]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (f *FakePixivAPI) DownloadIllust(url, filename string) (int64, string, error) {
+	return f.DownloadIllustWithContext(context.Background(), url, filename)
+}
+
+func (f *FakePixivAPI) DownloadIllustWithContext(ctx context.Context, url, filename string) (int64, string, error) {
+	rc, err := f.GetIllustWithContext(ctx, url)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		_ = rc.Close()
+	}()
+	return WriteFIleCalSha1(rc, filename)
+}
+
+func copyUserProfile(profile *UserProfile) *UserProfile {
+	c := *profile
+	if profile.Social != nil {
+		c.Social = copyMap(profile.Social)
+	}
+	return &c
+}
+
+// fakePage return the ids in [offset, offset+limit)
+func fakePage(ids []PixivID, offset, limit int32) []PixivID {
+	if offset < 0 || int(offset) >= len(ids) {
+		return nil
+	}
+	end := int(offset) + int(limit)
+	if limit <= 0 || end > len(ids) {
+		end = len(ids)
+	}
+	return ids[offset:end]
+}
@@ -0,0 +1,142 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFakePixivAPI(t *testing.T) {
+	var api PixivAPI
+	fake := NewFakePixivAPI()
+	api = fake
+
+	user := UserInfo{UserId: "1", UserName: "neko", UserAccount: "littleneko"}
+	fake.AddIllust(
+		&IllustInfo{Id: "100", Title: "p1", PageIdx: 1, PageCount: 2, UserInfo: user},
+		&IllustInfo{Id: "100", Title: "p0", PageIdx: 0, PageCount: 2, UserInfo: user, Urls: Urls{Original: "https://i.pximg.net/100_p0.png"}},
+	)
+	fake.AddIllust(&IllustInfo{Id: "99", Title: "single", PageCount: 1, UserInfo: user})
+	fake.AddBookmark("2", "100", "99")
+	fake.AddFollowing("2", "1")
+	fake.SetRank(IllustRankModeDaily, IllustRankContentAll, "20230117", "99")
+	fake.SetRank(IllustRankModeDaily, IllustRankContentAll, "20230118", "100", "99")
+	fake.AddImage("https://i.pximg.net/100_p0.png", []byte("image"))
+
+	ctx := context.Background()
+	pages, err := api.GetIllustInfoWithContext(ctx, "100", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].Title != "p0" || pages[1].Title != "p1" {
+		t.Errorf("unexpected pages: %+v", pages)
+	}
+	if _, err := api.GetIllustInfoWithContext(ctx, "1", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected: %v, acture: %v", ErrNotFound, err)
+	}
+
+	info, err := api.GetUserInfoWithContext(ctx, "1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserAccount != "littleneko" {
+		t.Errorf("unexpected user: %+v", info)
+	}
+
+	fake.AddUserProfile(&UserProfile{UserInfo: user, ImageBig: "i170", Following: 100,
+		Social: map[string]string{"twitter": "https://twitter.com/neko"}})
+	profile, err := api.GetUserProfileWithContext(ctx, "1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.Social["twitter"] = ""
+	if profile.ImageBig != "i170" || profile.Following != 100 {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+	profile, err = api.GetUserProfileWithContext(ctx, "1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.ImageBig != "i170" || profile.Following != 0 || profile.Social != nil {
+		t.Errorf("unexpected profile: %+v", profile)
+	}
+	profile, _ = api.GetUserProfileWithContext(ctx, "1", true)
+	if profile.Social["twitter"] != "https://twitter.com/neko" {
+		t.Errorf("the profile of the fake is modified: %+v", profile)
+	}
+
+	illusts, err := api.GetUserIllustsWithContext(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(illusts) != 2 || illusts[0] != "100" {
+		t.Errorf("unexpected illusts: %v", illusts)
+	}
+	if plain, err := api.GetUserIllusts("1"); err != nil || len(plain) != 2 {
+		t.Errorf("unexpected illusts: %v, err: %v", plain, err)
+	}
+
+	bookmarks, err := api.GetUserBookmarksWithContext(ctx, "2", 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookmarks.Total != 2 || len(bookmarks.Works) != 1 || bookmarks.Works[0].Id != "99" || bookmarks.Works[0].UserName != "neko" {
+		t.Errorf("unexpected bookmarks: %+v", bookmarks)
+	}
+
+	following, err := api.GetUserFollowingWithContext(ctx, "2", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if following.Total != 1 || following.Users[0].UserAccount != "littleneko" {
+		t.Errorf("unexpected following: %+v", following)
+	}
+
+	rank, err := api.IllustRankWithContext(ctx, IllustRankModeDaily, IllustRankContentAll, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rank.Date != "20230118" || rank.PrevDate != "20230117" || rank.NextDate != "false" ||
+		len(rank.Contents) != 2 || rank.Contents[1].Rank != 2 || rank.Contents[0].Title != "p0" {
+		t.Errorf("unexpected rank: %+v", rank)
+	}
+
+	size, _, err := api.DownloadIllustWithContext(ctx, pages[0].Urls.Original, filepath.Join(t.TempDir(), "100_p0.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 5 {
+		t.Errorf("expected: 5, acture: %d", size)
+	}
+}
+
+func TestFakePixivAPIAddIllust(t *testing.T) {
+	fake := NewFakePixivAPI()
+	user := UserInfo{UserId: "1", UserName: "neko"}
+	fake.AddIllust(
+		&IllustInfo{Id: "100", Title: "p0", PageIdx: 0, UserInfo: user},
+		&IllustInfo{Id: "100", Title: "p1", PageIdx: 1, UserInfo: user},
+	)
+
+	// re-seeding replace the pages, the pages of every illust in one call are ordered
+	fake.AddIllust(
+		&IllustInfo{Id: "100", Title: "p1 new", PageIdx: 1, UserInfo: user},
+		&IllustInfo{Id: "101", Title: "p1", PageIdx: 1, UserInfo: user},
+		&IllustInfo{Id: "101", Title: "p0", PageIdx: 0, UserInfo: user},
+	)
+	pages, err := fake.GetIllustInfo("100", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].Title != "p0" || pages[1].Title != "p1 new" {
+		t.Errorf("unexpected pages: %+v", pages)
+	}
+	pages, err = fake.GetIllustInfo("101", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].Title != "p0" || pages[1].Title != "p1" {
+		t.Errorf("unexpected pages: %+v", pages)
+	}
+}
@@ -0,0 +1,96 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveHeaders is the headers whose values are never logged
+var sensitiveHeaders = map[string]bool{
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"Authorization": true,
+	"X-Csrf-Token":  true,
+}
+
+// redactedHeader log the headers with the cookie values and other secrets redacted
+type redactedHeader http.Header
+
+func (h redactedHeader) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for k, values := range h {
+		value := strings.Join(values, ", ")
+		if k == "Cookie" {
+			value = redactCookie(value)
+		} else if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(k, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// redactCookie keep the cookie names and redact the values, e.g. "PHPSESSID=REDACTED; a=REDACTED"
+func redactCookie(cookie string) string {
+	parts := strings.Split(cookie, ";")
+	for i, part := range parts {
+		name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+		parts[i] = name + "=" + redacted
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (p *PixivClient) logRequest(trace *requestTrace, size int64, err error) {
+	if p.logger == nil {
+		return
+	}
+	level := slog.LevelInfo
+	msg := "pixiv request"
+	if err != nil {
+		level = slog.LevelWarn
+		msg = "pixiv request failed"
+	}
+	ctx := context.Background()
+	if trace.req != nil {
+		ctx = trace.req.Context()
+	}
+	if !p.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("endpoint", trace.endpoint),
+		slog.Int("status", trace.status),
+		slog.Duration("latency", time.Since(trace.start)),
+		slog.Int("retries", trace.attempts-1),
+		slog.Int64("size", size),
+	}
+	if trace.req != nil {
+		attrs = append(attrs, slog.String("method", trace.req.Method), slog.String("url", trace.req.URL.String()))
+		if p.logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("header", redactedHeader(trace.req.Header)))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	p.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (p *PixivClient) logRetry(trace *requestTrace, delay time.Duration, err error) {
+	if p.logger == nil {
+		return
+	}
+	p.logger.LogAttrs(trace.req.Context(), slog.LevelDebug, "pixiv request retry",
+		slog.String("endpoint", trace.endpoint),
+		slog.String("url", trace.req.URL.String()),
+		slog.Int("attempt", trace.attempts),
+		slog.Duration("delay", delay),
+		slog.String("error", err.Error()),
+	)
+}
@@ -0,0 +1,73 @@
+package pixiv_api_go
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithCookiePHPSESSID("secret_session"),
+		WithLogger(logger),
+	)
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if strings.Contains(out, "secret_session") {
+		t.Errorf("cookie value not redacted: %s", out)
+	}
+	for _, expected := range []string{"endpoint=" + EndpointUserIllusts, "status=200", "retries=0", "size=50", "PHPSESSID=REDACTED"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in log: %s", expected, out)
+		}
+	}
+}
+
+func TestJsonUnmarshalErrTruncated(t *testing.T) {
+	err := NewJsonUnmarshalErr(bytes.Repeat([]byte("x"), 10000), nil)
+	if msg := err.Error(); len(msg) > 2000 || !strings.Contains(msg, "10000 bytes") {
+		t.Errorf("unexpected error message length: %d", len(msg))
+	}
+}
+
+func TestIgnoredOptionsWarning(t *testing.T) {
+	rec, err := NewRecorder("unused.json", RecordModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	router := NewProxyRouter(nil)
+
+	NewPixivClientWithOptions(WithLogger(logger), WithTransport(rec), WithProxyRouter(router))
+	if out := buf.String(); !strings.Contains(out, "by=WithTransport") || !strings.Contains(out, "WithProxyRouter") {
+		t.Errorf("expected WithProxyRouter ignored by WithTransport: %s", out)
+	}
+
+	buf.Reset()
+	NewPixivClientWithOptions(WithLogger(logger), WithHttpClient(&http.Client{}), WithProxyRouter(router),
+		WithTransportConfig(func(tr *http.Transport) {}))
+	if out := buf.String(); !strings.Contains(out, "by=WithHttpClient") || !strings.Contains(out, "WithTransportConfig") {
+		t.Errorf("expected the transport options ignored by WithHttpClient: %s", out)
+	}
+
+	buf.Reset()
+	NewPixivClientWithOptions(WithLogger(logger), WithTransport(&http.Transport{}), WithProxyRouter(router))
+	if buf.Len() != 0 {
+		t.Errorf("unexpected warning: %s", buf.String())
+	}
+}
@@ -0,0 +1,411 @@
+package pixiv_api_go
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets is the histogram buckets in seconds of the request latency
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// MetricsRegistry is a small in-process metrics registry, it renders the metrics in the
+// Prometheus text exposition format and can be served as an http.Handler, e.g.
+//
+//	registry := NewMetricsRegistry()
+//	client := NewPixivClientWithOptions(WithMetrics(registry))
+//	http.Handle("/metrics", registry)
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics map[string]metricVec
+	order   []string
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: make(map[string]metricVec)}
+}
+
+type metricVec interface {
+	write(w *bufio.Writer)
+}
+
+// register add the metric if the name is not registered yet, otherwise the registered one is returned
+func (r *MetricsRegistry) register(name string, newVec func() metricVec) metricVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if vec, ok := r.metrics[name]; ok {
+		return vec
+	}
+	vec := newVec()
+	r.metrics[name] = vec
+	r.order = append(r.order, name)
+	return vec
+}
+
+// registeredTypePanic panic as the name is registered as another type of metric, which is
+// a programming error like registering the same name twice in Prometheus
+func registeredTypePanic(name string, registered metricVec, want metricVec) {
+	panic(fmt.Sprintf("metrics: %s is registered as %T, not %T", name, registered, want))
+}
+
+// NewCounterVec register a counter with the label names, the registered one is returned if the
+// name exists. It panics if the name is registered as another type of metric.
+func (r *MetricsRegistry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	registered := r.register(name, func() metricVec {
+		return &CounterVec{desc: newMetricDesc(name, help, "counter", labels)}
+	})
+	vec, ok := registered.(*CounterVec)
+	if !ok {
+		registeredTypePanic(name, registered, vec)
+	}
+	return vec
+}
+
+// NewGaugeVec register a gauge with the label names, the registered one is returned if the
+// name exists. It panics if the name is registered as another type of metric.
+func (r *MetricsRegistry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	registered := r.register(name, func() metricVec {
+		return &GaugeVec{desc: newMetricDesc(name, help, "gauge", labels)}
+	})
+	vec, ok := registered.(*GaugeVec)
+	if !ok {
+		registeredTypePanic(name, registered, vec)
+	}
+	return vec
+}
+
+// NewHistogramVec register a histogram with the upper bounds of the buckets and the label names,
+// the registered one is returned if the name exists. It panics if the name is registered as
+// another type of metric.
+func (r *MetricsRegistry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	registered := r.register(name, func() metricVec {
+		b := append([]float64(nil), buckets...)
+		sort.Float64s(b)
+		return &HistogramVec{desc: newMetricDesc(name, help, "histogram", labels), buckets: b}
+	})
+	vec, ok := registered.(*HistogramVec)
+	if !ok {
+		registeredTypePanic(name, registered, vec)
+	}
+	return vec
+}
+
+// WriteTo write all the metrics in the Prometheus text exposition format
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	vecs := make([]metricVec, 0, len(r.order))
+	for _, name := range r.order {
+		vecs = append(vecs, r.metrics[name])
+	}
+	r.mu.Unlock()
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, vec := range vecs {
+		vec.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type metricDesc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func newMetricDesc(name, help, typ string, labels []string) metricDesc {
+	return metricDesc{name: name, help: help, typ: typ, labels: append([]string(nil), labels...)}
+}
+
+func (d *metricDesc) writeHeader(w *bufio.Writer) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.typ)
+}
+
+// seriesKey join the label values as the map key of a series
+func (d *metricDesc) seriesKey(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelString render {a="1",b="2"}, extra is appended as is, e.g. le="0.5"
+func (d *metricDesc) labelString(key string, extra string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabelValue(value)+`"`)
+		}
+	}
+	if len(extra) > 0 {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter partitioned by the label values
+type CounterVec struct {
+	desc   metricDesc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Add add delta (must be >= 0) to the counter of the label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	key := c.desc.seriesKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[key] += delta
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value return the current value of the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.desc.seriesKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.desc.writeHeader(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", c.desc.name, c.desc.labelString(key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// GaugeVec is a gauge partitioned by the label values
+type GaugeVec struct {
+	desc   metricDesc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Add add delta (can be negative) to the gauge of the label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	key := g.desc.seriesKey(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.values == nil {
+		g.values = make(map[string]float64)
+	}
+	g.values[key] += delta
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.desc.seriesKey(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.values == nil {
+		g.values = make(map[string]float64)
+	}
+	g.values[key] = value
+}
+
+// Value return the current value of the label values
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	key := g.desc.seriesKey(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.desc.writeHeader(w)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range sortedKeys(g.values) {
+		_, _ = fmt.Fprintf(w, "%s%s %s\n", g.desc.name, g.desc.labelString(key, ""), formatFloat(g.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by the label values
+type HistogramVec struct {
+	desc    metricDesc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64 // not cumulative, the last one is +Inf
+	count  uint64
+	sum    float64
+}
+
+// Observe add an observation to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.desc.seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.values == nil {
+		h.values = make(map[string]*histogramValue)
+	}
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets)+1)}
+		h.values[key] = hv
+	}
+	idx := sort.SearchFloat64s(h.buckets, value)
+	hv.counts[idx]++
+	hv.count++
+	hv.sum += value
+}
+
+// Count return the number of observations of the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.desc.seriesKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hv, ok := h.values[key]; ok {
+		return hv.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.desc.writeHeader(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.desc.name, h.desc.labelString(key, `le="`+formatFloat(upper)+`"`), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", h.desc.name, h.desc.labelString(key, `le="+Inf"`), hv.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", h.desc.name, h.desc.labelString(key, ""), formatFloat(hv.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", h.desc.name, h.desc.labelString(key, ""), hv.count)
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(v string) string {
+	return helpReplacer.Replace(v)
+}
+
+// clientMetrics is the metrics recorded by PixivClient, all methods are no-op on nil
+type clientMetrics struct {
+	requests      *CounterVec
+	retries       *CounterVec
+	latency       *HistogramVec
+	inFlight      *GaugeVec
+	downloadBytes *CounterVec
+}
+
+func newClientMetrics(registry *MetricsRegistry) *clientMetrics {
+	if registry == nil {
+		return nil
+	}
+	return &clientMetrics{
+		requests: registry.NewCounterVec("pixiv_requests_total",
+			"Total number of pixiv requests by endpoint and status class.", "endpoint", "status_class"),
+		retries: registry.NewCounterVec("pixiv_request_retries_total",
+			"Total number of retried pixiv requests by endpoint.", "endpoint"),
+		latency: registry.NewHistogramVec("pixiv_request_duration_seconds",
+			"Latency of pixiv requests including retries and reading the body.", DefaultLatencyBuckets, "endpoint"),
+		inFlight: registry.NewGaugeVec("pixiv_requests_in_flight",
+			"Number of pixiv requests in flight by endpoint.", "endpoint"),
+		downloadBytes: registry.NewCounterVec("pixiv_download_bytes_total",
+			"Total bytes of the downloaded images.", "endpoint"),
+	}
+}
+
+// statusClass return 2xx, 4xx... or "error" if no response is received
+func statusClass(status int) string {
+	if status <= 0 {
+		return "error"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func (m *clientMetrics) requestStarted(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(1, endpoint)
+}
+
+func (m *clientMetrics) requestRetried(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.retries.Inc(endpoint)
+}
+
+func (m *clientMetrics) requestFinished(trace *requestTrace, size int64) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Add(-1, trace.endpoint)
+	m.requests.Inc(trace.endpoint, statusClass(trace.status))
+	m.latency.Observe(time.Since(trace.start).Seconds(), trace.endpoint)
+	if trace.endpoint == EndpointIllustDownload {
+		m.downloadBytes.Add(float64(size), trace.endpoint)
+	}
+}
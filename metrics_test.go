@@ -0,0 +1,76 @@
+package pixiv_api_go
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ajax/user/1/profile/all", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	})
+	mux.HandleFunc("/img/1.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("0123456789"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	registry := NewMetricsRegistry()
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithMetrics(registry))
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetUserIllusts("2"); err == nil {
+		t.Fatal("expected not found error")
+	}
+	if _, err := client.GetIllustData(server.URL + "/img/1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	metricsServer := httptest.NewServer(registry)
+	defer metricsServer.Close()
+	resp, err := http.Get(metricsServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, _ := io.ReadAll(resp.Body)
+	out := string(body)
+
+	for _, expected := range []string{
+		"# TYPE pixiv_requests_total counter",
+		`pixiv_requests_total{endpoint="user.illusts",status_class="2xx"} 1`,
+		`pixiv_requests_total{endpoint="user.illusts",status_class="4xx"} 1`,
+		`pixiv_request_duration_seconds_bucket{endpoint="user.illusts",le="+Inf"} 2`,
+		`pixiv_request_duration_seconds_count{endpoint="illust.download"} 1`,
+		`pixiv_requests_in_flight{endpoint="user.illusts"} 0`,
+		`pixiv_download_bytes_total{endpoint="illust.download"} 10`,
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in metrics:\n%s", expected, out)
+		}
+	}
+}
+
+func TestMetricsTypeMismatch(t *testing.T) {
+	r := NewMetricsRegistry()
+	r.NewCounterVec("pixiv_test_total", "test", "endpoint")
+	if vec := r.NewCounterVec("pixiv_test_total", "test", "endpoint"); vec == nil {
+		t.Error("expected the registered counter")
+	}
+
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "pixiv_test_total") || !strings.Contains(msg, "*pixiv_api_go.CounterVec") ||
+			!strings.Contains(msg, "*pixiv_api_go.GaugeVec") {
+			t.Errorf("unexpected panic: %q", msg)
+		}
+	}()
+	r.NewGaugeVec("pixiv_test_total", "test", "endpoint")
+}
@@ -0,0 +1,44 @@
+package pixiv_api_go
+
+import "net/http"
+
+// The logical endpoint names passed to the middlewares
+const (
+	EndpointUserBookmarks  = "user.bookmarks"
+	EndpointUserFollowing  = "user.following"
+	EndpointUserIllusts    = "user.illusts"
+	EndpointUserInfo       = "user.info"
+	EndpointSelfStatus     = "self.status"
+	EndpointIllustInfo     = "illust.info"
+	EndpointIllustPages    = "illust.pages"
+	EndpointIllustRank     = "illust.rank"
+	EndpointIllustDownload = "illust.download"
+	EndpointOAuthToken     = "oauth.token"
+	EndpointCsrfToken      = "csrf.token"
+	EndpointAjaxGet        = "ajax.get"
+	EndpointAjaxPost       = "ajax.post"
+)
+
+// Handler send the request of the endpoint and return the raw response, the response
+// with a non 200 status code is returned without error.
+type Handler func(endpoint string, req *http.Request) (*http.Response, error)
+
+// Middleware wrap a Handler, e.g. logging, signing the headers or rewriting the response.
+// The middlewares are called for every attempt, including the retries.
+//
+//	func logging(next Handler) Handler {
+//	    return func(endpoint string, req *http.Request) (*http.Response, error) {
+//	        resp, err := next(endpoint, req)
+//	        log.Printf("%s %s, err: %v", endpoint, req.URL, err)
+//	        return resp, err
+//	    }
+//	}
+type Middleware func(next Handler) Handler
+
+// chainMiddlewares wrap the handler with the middlewares, the first one is the outermost
+func chainMiddlewares(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
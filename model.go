@@ -22,6 +22,11 @@ func (w *PixivID) UnmarshalJSON(data []byte) (err error) {
 	if err != nil {
 		return err
 	}
+	// the empty id is the zero value, e.g. saved by json.Marshal, it must be read back
+	if len(str) == 0 {
+		*w = ""
+		return nil
+	}
 	return json.Unmarshal([]byte(str), w)
 }
 
@@ -37,6 +42,39 @@ type UserInfo struct {
 	UserAccount string  `json:"userAccount"`
 }
 
+// SelfInfo is the logged-in user of the session
+type SelfInfo struct {
+	UserInfo
+	Premium bool `json:"premium"`
+	// XRestrict is the highest restrict level the user chose to show
+	XRestrict XRestrictLevel `json:"xRestrict"`
+	ShowR18   bool           `json:"showR18"`
+	ShowR18G  bool           `json:"showR18G"`
+}
+
+// UserProfile is the user info get from the user api
+type UserProfile struct {
+	UserInfo
+	// Image is the url of the 50px avatar, ImageBig is the 170px one
+	Image      string `json:"image"`
+	ImageBig   string `json:"imageBig"`
+	Premium    bool   `json:"premium"`
+	IsFollowed bool   `json:"isFollowed"`
+
+	// the fields below are only filled in the full mode
+	Background   string `json:"background"`
+	Following    int    `json:"following"`
+	MypixivCount int    `json:"mypixivCount"`
+	Comment      string `json:"comment"`
+	Webpage      string `json:"webpage"`
+	// Social is the url of the social services, e.g. twitter, instagram, pawoo
+	Social map[string]string `json:"social"`
+	Region string            `json:"region"`
+	// Birthday is empty if the user hides it, BirthdayVisible is true if it is public
+	Birthday        string `json:"birthday"`
+	BirthdayVisible bool   `json:"birthdayVisible"`
+}
+
 // IllustDigest is the illust basic info get from bookmarks or artist work
 type IllustDigest struct {
 	Id           PixivID       `json:"id"`
@@ -265,6 +303,18 @@ func (i *IllustInfo) ToJson(ident bool) string {
 	return string(j)
 }
 
+// UgoiraFrame is a frame of the ugoira zip, Delay is in milliseconds
+type UgoiraFrame struct {
+	File  string `json:"file"`
+	Delay int    `json:"delay"`
+}
+
+// UgoiraMetadata is the zip url and the frames of an ugoira
+type UgoiraMetadata struct {
+	ZipUrl string        `json:"zipUrl"`
+	Frames []UgoiraFrame `json:"frames"`
+}
+
 type IllustRankMode string
 
 type IllustRankContent string
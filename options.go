@@ -0,0 +1,319 @@
+package pixiv_api_go
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures the PixivClient created by NewPixivClientWithOptions
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	timeout    time.Duration
+	httpClient *http.Client
+	transport  http.RoundTripper
+	proxy      *url.URL
+	trConfigs  []func(tr *http.Transport)
+
+	header   map[string]string
+	cookie   map[string]string
+	lang     string
+	baseUrls BaseUrls
+
+	retryPolicy  *RetryPolicy
+	apiLimiter   *RateLimiter
+	imageLimiter *RateLimiter
+	middlewares  []Middleware
+	logger       *slog.Logger
+	metrics      *MetricsRegistry
+	cache        Cache
+	cacheTTLs    map[string]time.Duration
+	noCoalescing bool
+	sessions     *SessionPool
+	proxyRouter  *ProxyRouter
+	breaker      *BreakerConfig
+	jar          http.CookieJar
+}
+
+// WithTimeout set the timeout of every request, zero means no timeout
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithHttpClient use a custom http.Client, a copy of it is used so the caller's client is
+// never modified. It takes precedence over all the transport options: WithTransport,
+// WithProxy, WithProxyRouter and WithTransportConfig are ignored with a warning if it is set.
+func WithHttpClient(client *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport use a custom http.RoundTripper, WithProxy is ignored if it is set. If it is
+// not a *http.Transport, WithProxyRouter and WithTransportConfig are ignored with a warning.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+// WithProxy send all the requests through the proxy, the proxy from environment is used by default
+func WithProxy(proxy *url.URL) Option {
+	return func(o *clientOptions) {
+		o.proxy = proxy
+	}
+}
+
+// WithTransportConfig tune the http.Transport, e.g. MaxIdleConnsPerHost, IdleConnTimeout.
+// It is applied to a clone if the transport set by WithTransport is a *http.Transport.
+func WithTransportConfig(config func(tr *http.Transport)) Option {
+	return func(o *clientOptions) {
+		o.trConfigs = append(o.trConfigs, config)
+	}
+}
+
+// WithHeader add the headers to every request
+func WithHeader(header map[string]string) Option {
+	return func(o *clientOptions) {
+		for k, v := range header {
+			o.header[k] = v
+		}
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.header["User-Agent"] = userAgent
+	}
+}
+
+// WithCookie add the cookies to every request
+func WithCookie(cookie map[string]string) Option {
+	return func(o *clientOptions) {
+		for k, v := range cookie {
+			o.cookie[k] = v
+		}
+	}
+}
+
+func WithCookiePHPSESSID(value string) Option {
+	return func(o *clientOptions) {
+		o.cookie["PHPSESSID"] = value
+	}
+}
+
+// WithLang set the lang param of the api, default zh
+func WithLang(lang string) Option {
+	return func(o *clientOptions) {
+		o.lang = lang
+	}
+}
+
+// WithBaseUrls override the hosts of the web api, ranking and images, see BaseUrls
+func WithBaseUrls(baseUrls BaseUrls) Option {
+	return func(o *clientOptions) {
+		o.baseUrls = baseUrls
+	}
+}
+
+// WithRetryPolicy retry the failed GET requests according to the policy, e.g. DefaultRetryPolicy.
+// No request is retried by default.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retryPolicy = &policy
+	}
+}
+
+// WithApiRateLimit limit the requests to the web api and ranking to rate per second with
+// bursts of at most burst requests, the limit is shared by all the goroutines using the client
+func WithApiRateLimit(rate float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.apiLimiter = NewRateLimiter(rate, burst)
+	}
+}
+
+// WithImageRateLimit limit the image downloads to rate per second with bursts of at most burst requests
+func WithImageRateLimit(rate float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.imageLimiter = NewRateLimiter(rate, burst)
+	}
+}
+
+// WithMiddleware add the middlewares to the request chain, the first one is the outermost
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(o *clientOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithLogger log every request with the logger, the cookie values and other secrets are redacted.
+// The finished requests are logged at Info level, the failed ones at Warn level, and the
+// retries and request headers at Debug level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *clientOptions) {
+		o.logger = logger
+	}
+}
+
+// WithMetrics record the request counters, latency histograms, in-flight gauges and the
+// download bytes in the registry, the registry can be shared by multiple clients
+func WithMetrics(registry *MetricsRegistry) Option {
+	return func(o *clientOptions) {
+		o.metrics = registry
+	}
+}
+
+// WithCache look up the responses of the metadata endpoints in the cache before sending
+// the requests. ttls is the per endpoint ttl, e.g. {EndpointIllustInfo: time.Hour}, the
+// endpoints not in it are never cached, DefaultCacheTTL is used if ttls is nil.
+// The responses are cached per session, so with a SessionPool a request only hits the
+// responses got by the session it picked.
+func WithCache(cache Cache, ttls map[string]time.Duration) Option {
+	return func(o *clientOptions) {
+		if ttls == nil {
+			ttls = DefaultCacheTTL
+		}
+		o.cache = cache
+		o.cacheTTLs = make(map[string]time.Duration, len(ttls))
+		for k, v := range ttls {
+			o.cacheTTLs[k] = v
+		}
+	}
+}
+
+// WithRequestCoalescing enable or disable collapsing the concurrent identical api requests
+// into one network round trip, it is enabled by default. Image downloads are never coalesced,
+// nor the requests picking different sessions of a SessionPool.
+func WithRequestCoalescing(enabled bool) Option {
+	return func(o *clientOptions) {
+		o.noCoalescing = !enabled
+	}
+}
+
+// WithSessionPool spread the requests across the accounts of the pool, the cookies of the
+// picked session override the client cookies. The cache and the request coalescing are
+// per session, so their hit rate drops as the requests are spread.
+func WithSessionPool(pool *SessionPool) Option {
+	return func(o *clientOptions) {
+		o.sessions = pool
+	}
+}
+
+// WithProxyRouter select the proxy of every request by the router, it overrides WithProxy.
+// It is applied to a clone if the transport set by WithTransport is a *http.Transport, and
+// ignored with a warning if WithHttpClient or a WithTransport of another type is set.
+func WithProxyRouter(router *ProxyRouter) Option {
+	return func(o *clientOptions) {
+		o.proxyRouter = router
+	}
+}
+
+// WithCircuitBreaker enable a circuit breaker per upstream host, the zero config uses the defaults
+func WithCircuitBreaker(config BreakerConfig) Option {
+	return func(o *clientOptions) {
+		o.breaker = &config
+	}
+}
+
+// WithCookieJar store the Set-Cookie of the responses in the jar and send the cookies in it,
+// which override the cookies set by WithCookie. Use PersistentJar to keep the session across
+// restarts. The Jar of the http.Client set by WithHttpClient is used if it is not set.
+// The jar is shared by the client, so the requests sent by a session of the SessionPool
+// neither send the cookies in it nor store the cookies of their responses.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *clientOptions) {
+		o.jar = jar
+	}
+}
+
+// warnIgnored log the options ignored as the option taking precedence is set, by the
+// logger of WithLogger or slog.Default, so that a conflicting config is never silent
+func (o *clientOptions) warnIgnored(by string, ignored []string) {
+	if len(ignored) == 0 {
+		return
+	}
+	logger := o.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Warn("pixiv client options ignored", "by", by, "ignored", ignored)
+}
+
+func (o *clientOptions) buildHttpClient() *http.Client {
+	if o.httpClient != nil {
+		var ignored []string
+		if o.transport != nil {
+			ignored = append(ignored, "WithTransport")
+		}
+		if o.proxy != nil {
+			ignored = append(ignored, "WithProxy")
+		}
+		if o.proxyRouter != nil {
+			ignored = append(ignored, "WithProxyRouter")
+		}
+		if len(o.trConfigs) > 0 {
+			ignored = append(ignored, "WithTransportConfig")
+		}
+		o.warnIgnored("WithHttpClient", ignored)
+
+		client := *o.httpClient
+		if client.Jar != nil {
+			if o.jar == nil {
+				o.jar = client.Jar
+			}
+			client.Jar = nil
+		}
+		if o.timeout > 0 {
+			client.Timeout = o.timeout
+		}
+		return &client
+	}
+
+	transport := o.transport
+	if transport != nil {
+		var ignored []string
+		if o.proxy != nil {
+			ignored = append(ignored, "WithProxy")
+		}
+		if _, ok := transport.(*http.Transport); !ok {
+			if o.proxyRouter != nil {
+				ignored = append(ignored, "WithProxyRouter")
+			}
+			if len(o.trConfigs) > 0 {
+				ignored = append(ignored, "WithTransportConfig")
+			}
+		}
+		o.warnIgnored("WithTransport", ignored)
+	}
+	if transport == nil {
+		tr := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if o.proxy != nil {
+			tr.Proxy = http.ProxyURL(o.proxy)
+		}
+		transport = tr
+	}
+	tr, isTransport := transport.(*http.Transport)
+	if isTransport && (len(o.trConfigs) > 0 || o.proxyRouter != nil) {
+		if o.transport != nil {
+			tr = tr.Clone()
+		}
+		if o.proxyRouter != nil {
+			tr.Proxy = o.proxyRouter.Proxy
+		}
+		for _, config := range o.trConfigs {
+			config(tr)
+		}
+		transport = tr
+	}
+	if isTransport && o.proxyRouter != nil {
+		transport = &proxyReportTransport{next: transport}
+	}
+	return &http.Client{
+		Timeout:   o.timeout,
+		Transport: transport,
+	}
+}
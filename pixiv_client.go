@@ -1,35 +1,100 @@
 package pixiv_api_go
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	userBookmarksUrl = "https://www.pixiv.net/ajax/user/%s/illusts/bookmarks"
-	userFollowingUrl = "https://www.pixiv.net/ajax/user/%s/following"
-	illustInfoUrl    = "https://www.pixiv.net/ajax/illust/%s"
-	illustPagesUrl   = "https://www.pixiv.net/ajax/illust/%s/pages"
-	userIllustUrl    = "https://www.pixiv.net/ajax/user/%s/profile/all"
-	userInfoUrl      = "https://www.pixiv.net/ajax/user/%s"
-	illustRankUrl    = "https://www.pixiv.net/ranking.php"
-	illustSearchUrl  = "https://www.pixiv.net/ajax/search/artworks"
+	DefaultWebBaseUrl   = "https://www.pixiv.net"
+	DefaultRankBaseUrl  = "https://www.pixiv.net"
+	DefaultImageBaseUrl = "https://i.pximg.net"
 )
 
 const (
-	userBookmarksReferUrl  = "https://www.pixiv.net/users/%s/bookmarks/artworks"
-	userFollowingReferUrl  = "https://www.pixiv.net/users/%s/following"
-	illustInfoReferUrl     = "https://www.pixiv.net/artworks/%s"
-	userIllustReferUrl     = "https://www.pixiv.net/users/%s"
-	illustDownloadReferUrl = "https://www.pixiv.net"
+	userBookmarksPath = "/ajax/user/%s/illusts/bookmarks"
+	userFollowingPath = "/ajax/user/%s/following"
+	illustInfoPath    = "/ajax/illust/%s"
+	illustPagesPath   = "/ajax/illust/%s/pages"
+	userIllustPath    = "/ajax/user/%s/profile/all"
+	userInfoPath      = "/ajax/user/%s"
+	illustRankPath    = "/ranking.php"
+	illustSearchPath  = "/ajax/search/artworks"
+	selfStatusPath    = "/touch/ajax/user/self/status"
 )
 
+const (
+	userBookmarksReferPath = "/users/%s/bookmarks/artworks"
+	userFollowingReferPath = "/users/%s/following"
+	illustInfoReferPath    = "/artworks/%s"
+	userIllustReferPath    = "/users/%s"
+)
+
+// BaseUrls is the hosts the client sends requests to, override them to use a mirror,
+// a reverse proxy or a local test server. The empty field means using the default.
+type BaseUrls struct {
+	// Web is the base url of the ajax api, also used as the Referer, default https://www.pixiv.net
+	Web string
+	// Rank is the base url of ranking.php, default https://www.pixiv.net
+	Rank string
+	// Image is the base url replacing https://i.pximg.net in the illust urls, default https://i.pximg.net
+	Image string
+}
+
+func (b BaseUrls) withDefault() BaseUrls {
+	if len(b.Web) == 0 {
+		b.Web = DefaultWebBaseUrl
+	}
+	if len(b.Rank) == 0 {
+		b.Rank = DefaultRankBaseUrl
+	}
+	if len(b.Image) == 0 {
+		b.Image = DefaultImageBaseUrl
+	}
+	b.Web = strings.TrimSuffix(b.Web, "/")
+	b.Rank = strings.TrimSuffix(b.Rank, "/")
+	b.Image = strings.TrimSuffix(b.Image, "/")
+	return b
+}
+
+func (b BaseUrls) webUrl(pathFmt string, args ...any) string {
+	return b.Web + fmt.Sprintf(pathFmt, args...)
+}
+
+// imageUrl rewrite the i.pximg.net url to the Image base url, other urls are returned as is
+func (b BaseUrls) imageUrl(rawUrl string) string {
+	if b.Image == DefaultImageBaseUrl {
+		return rawUrl
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	def, _ := url.Parse(DefaultImageBaseUrl)
+	if u.Host != def.Host {
+		return rawUrl
+	}
+	base, err := url.Parse(b.Image)
+	if err != nil {
+		return rawUrl
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Path = base.Path + u.Path
+	return u.String()
+}
+
 type pageUrlType int
 
 const (
@@ -37,14 +102,14 @@ const (
 	pageUrlTypeFollowing
 )
 
-func genPageUrl(uid string, offset, limit int32, urlType pageUrlType) (string, error) {
+func genPageUrl(baseUrls BaseUrls, uid string, offset, limit int32, urlType pageUrlType) (string, error) {
 	var pUrl *url.URL
 	switch urlType {
 	case pageUrlTypeBookmarks:
-		pUrl, _ = url.Parse(fmt.Sprintf(userBookmarksUrl, uid))
+		pUrl, _ = url.Parse(baseUrls.webUrl(userBookmarksPath, uid))
 		break
 	case pageUrlTypeFollowing:
-		pUrl, _ = url.Parse(fmt.Sprintf(userFollowingUrl, uid))
+		pUrl, _ = url.Parse(baseUrls.webUrl(userFollowingPath, uid))
 		break
 	default:
 		return "", errors.New("unknown page type")
@@ -60,94 +125,308 @@ func genPageUrl(uid string, offset, limit int32, urlType pageUrlType) (string, e
 	return pUrl.String(), nil
 }
 
+// PixivClient is safe for concurrent use by multiple goroutines, the setters can be
+// called while other goroutines are sending requests. Use ContextWithRequestOptions
+// to override the headers, cookies or lang for some requests only.
 type PixivClient struct {
-	client *http.Client
-
+	client      *http.Client
+	handler     Handler
+	retryPolicy *RetryPolicy
+	logger      *slog.Logger
+	metrics     *clientMetrics
+	cache       Cache
+	cacheTTLs   map[string]time.Duration
+	flights     *flightGroup
+	sessions    *SessionPool
+	breakers    *breakerGroup
+	jar         http.CookieJar
+	csrf        csrfCache
+
+	apiLimiter   *RateLimiter
+	imageLimiter *RateLimiter
+
+	// mu guards the fields below, the maps are copy-on-write and never modified
+	// after being set by the setters, so they can be read without lock once got
+	mu       sync.RWMutex
+	baseUrls BaseUrls
+
+	// Deprecated: Header is kept for compatibility, writing it directly is not safe
+	// while requests are being sent. Use SetHeader, AddHeader and GetHeader instead.
 	Header map[string]string
+	// Deprecated: Cookie is kept for compatibility, writing it directly is not safe
+	// while requests are being sent. Use SetCookie, AddCookie and GetCookie instead.
 	Cookie map[string]string
-	Lang   string
+	// Deprecated: Lang is kept for compatibility, writing it directly is not safe
+	// while requests are being sent. Use SetLang and GetLang instead.
+	Lang string
 }
 
 func NewPixivClient(timeoutMs int32) *PixivClient {
-	return NewPixivClientWithProxy(nil, timeoutMs)
+	return NewPixivClientWithOptions(WithTimeout(time.Duration(timeoutMs) * time.Millisecond))
 }
 
 func NewPixivClientWithProxy(proxy *url.URL, timeoutMs int32) *PixivClient {
-	var tr *http.Transport
-	if proxy != nil {
-		tr = &http.Transport{Proxy: http.ProxyURL(proxy)}
-	} else {
-		tr = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	return NewPixivClientWithOptions(WithProxy(proxy), WithTimeout(time.Duration(timeoutMs)*time.Millisecond))
+}
+
+// NewPixivClientWithOptions create a client configured by the options, e.g.
+//
+//	client := NewPixivClientWithOptions(
+//	    WithTimeout(5*time.Second),
+//	    WithUserAgent(userAgent),
+//	    WithCookiePHPSESSID(sessionId),
+//	)
+func NewPixivClientWithOptions(opts ...Option) *PixivClient {
+	o := &clientOptions{
+		header: make(map[string]string),
+		cookie: make(map[string]string),
+		lang:   "zh",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	client := o.buildHttpClient()
+	send := func(_ string, req *http.Request) (*http.Response, error) {
+		return client.Do(req)
 	}
 	pc := &PixivClient{
-		client: &http.Client{
-			Timeout:   time.Duration(timeoutMs) * time.Millisecond,
-			Transport: tr,
-		},
-		Header: make(map[string]string),
-		Cookie: make(map[string]string),
-		Lang:   "zh",
+		client:       client,
+		handler:      chainMiddlewares(send, o.middlewares),
+		baseUrls:     o.baseUrls.withDefault(),
+		retryPolicy:  o.retryPolicy,
+		logger:       o.logger,
+		metrics:      newClientMetrics(o.metrics),
+		cache:        o.cache,
+		cacheTTLs:    o.cacheTTLs,
+		apiLimiter:   o.apiLimiter,
+		imageLimiter: o.imageLimiter,
+		Header:       o.header,
+		Cookie:       o.cookie,
+		Lang:         o.lang,
+		sessions:     o.sessions,
+		breakers:     newBreakerGroup(o.breaker),
+		jar:          o.jar,
+	}
+	if !o.noCoalescing {
+		pc.flights = &flightGroup{}
 	}
 	return pc
 }
 
 func (p *PixivClient) SetHeader(header map[string]string) {
-	p.Header = header
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Header = copyMap(header)
 }
 
 func (p *PixivClient) AddHeader(key, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Header = copyMap(p.Header)
 	p.Header[key] = value
 }
 
+// GetHeader return a copy of the headers added to every request
+func (p *PixivClient) GetHeader() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return copyMap(p.Header)
+}
+
 func (p *PixivClient) SetUserAgent(value string) {
 	p.AddHeader("User-Agent", value)
 }
 
 func (p *PixivClient) SetCookie(cookie map[string]string) {
-	p.Cookie = cookie
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Cookie = copyMap(cookie)
 }
 
 func (p *PixivClient) AddCookie(key, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Cookie = copyMap(p.Cookie)
 	p.Cookie[key] = value
 }
 
+// GetCookie return a copy of the cookies added to every request
+func (p *PixivClient) GetCookie() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return copyMap(p.Cookie)
+}
+
 func (p *PixivClient) SetCookiePHPSESSID(value string) {
-	p.Cookie["PHPSESSID"] = value
+	p.AddCookie("PHPSESSID", value)
 }
 
 func (p *PixivClient) SetLang(lang string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.Lang = lang
 }
 
+func (p *PixivClient) GetLang() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.Lang
+}
+
+// SetBaseUrls override the hosts of the web api, ranking and images, the Referer
+// headers are rewritten to the Web base url too
+func (p *PixivClient) SetBaseUrls(baseUrls BaseUrls) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.baseUrls = baseUrls.withDefault()
+}
+
+// BaseUrls return the hosts currently used by the client
+func (p *PixivClient) BaseUrls() BaseUrls {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.baseUrls
+}
+
+// Login is intentionally unsupported and always returns an error, as pixiv disabled the
+// password login. PixivClient is authenticated by the cookies of a browser session
+// (SetCookiePHPSESSID, ImportCookiesFile), only OAuthClient and AppClient use the oauth tokens.
 func (p *PixivClient) Login(user, password string) error {
-	return errors.New("not supported")
+	return errors.New("password login is not supported by pixiv, use the session cookie or OAuthClient")
+}
+
+func (p *PixivClient) getRaw(ctx context.Context, endpoint, url, refer string) (*http.Response, error) {
+	return p.send(ctx, endpoint, "GET", url, refer, nil, nil)
 }
 
-func (p *PixivClient) getRaw(url, refer string) (*http.Response, error) {
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("Referer", refer)
-	for k, v := range p.Header {
-		req.Header.Add(k, v)
+// send the request with the client headers and cookies, extraHeader is set after the
+// client headers. The non GET requests use the write session of the pool.
+func (p *PixivClient) send(ctx context.Context, endpoint, method, url, refer string, extraHeader map[string]string, body []byte) (*http.Response, error) {
+	newReq := func() (*http.Request, error) {
+		session, err := p.pickSession(ctx, method != "GET")
+		if err != nil {
+			return nil, err
+		}
+		reqCtx := ctx
+		if session != nil {
+			reqCtx = context.WithValue(ctx, requestSessionKey{}, session)
+		}
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(reqCtx, method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		header, cookie := p.requestHeaderAndSessionCookie(ctx, session)
+		req.Header.Set("Referer", refer)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		for k, v := range extraHeader {
+			req.Header.Set(k, v)
+		}
+		p.addRequestCookies(ctx, req, session, cookie)
+		return req, nil
 	}
-	for k, v := range p.Cookie {
-		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	return p.do(ctx, endpoint, newReq)
+}
+
+// requestSessionKey is the context key of the session picked for a request
+type requestSessionKey struct{}
+
+// do send the request built by newReq, retry it according to the retry policy.
+// newReq is called for every attempt so that the request body can be rebuilt.
+func (p *PixivClient) do(ctx context.Context, endpoint string, newReq func() (*http.Request, error)) (*http.Response, error) {
+	trace := &requestTrace{endpoint: endpoint, start: time.Now()}
+	p.metrics.requestStarted(endpoint)
+	for attempt := 1; ; attempt++ {
+		trace.attempts = attempt
+		req, err := newReq()
+		if err != nil {
+			return nil, p.finishRequest(trace, 0, err)
+		}
+		trace.req = req
+
+		if err := p.waitRateLimit(ctx, req.URL); err != nil {
+			return nil, p.finishRequest(trace, 0, err)
+		}
+		if err := p.breakers.allow(req.URL.Host); err != nil {
+			return nil, p.finishRequest(trace, 0, err)
+		}
+		resp, err := p.doOnce(ctx, endpoint, req)
+		p.breakers.report(req.URL.Host, resp, err)
+		if resp != nil {
+			trace.status = resp.StatusCode
+		}
+		// the success is reported by the caller holding the picked session once the
+		// response is parsed, as the pixiv error of a 200 response is a failure
+		if session, ok := req.Context().Value(requestSessionKey{}).(*pooledSession); ok && !reportedByHolder(ctx, err) {
+			p.sessions.report(session, err)
+		}
+		if err == nil {
+			resp.Body = &tracedBody{rc: resp.Body, client: p, trace: trace}
+			return resp, nil
+		}
+		if !p.retryPolicy.enabled() || attempt >= p.retryPolicy.MaxAttempts || ctx.Err() != nil ||
+			!p.retryPolicy.retryable(req, resp, err) {
+			return nil, p.finishRequest(trace, 0, err)
+		}
+		delay := p.retryPolicy.delay(attempt, resp)
+		p.metrics.requestRetried(endpoint)
+		p.logRetry(trace, delay, err)
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, p.finishRequest(trace, 0, err)
+		}
 	}
+}
 
-	resp, err := p.client.Do(req)
+// doOnce send the request, the response body is closed and the response with
+// only status and headers is returned if the status is not 200
+func (p *PixivClient) doOnce(ctx context.Context, endpoint string, req *http.Request) (*http.Response, error) {
+	resp, err := p.handler(endpoint, req)
 	if err != nil {
-		return resp, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
 	}
-	if resp.StatusCode == 404 {
-		return resp, ErrNotFound
+	// the jar is shared by the client, so the cookies set for a session from the pool are dropped
+	if _, pooled := req.Context().Value(requestSessionKey{}).(*pooledSession); p.jar != nil && !pooled {
+		p.jar.SetCookies(req.URL, resp.Cookies())
 	}
-	if resp.StatusCode != 200 {
-		return resp, errors.New(fmt.Sprintf("code: %d, message: %s", resp.StatusCode, resp.Status))
+	if resp.StatusCode == 200 {
+		return resp, nil
 	}
-	return resp, nil
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+	_ = resp.Body.Close()
+	return resp, &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		URL:        req.URL.String(),
+		Body:       string(body),
+	}
+}
+
+// getRawDate read the whole response body, the concurrent calls of the same request are
+// coalesced into one network round trip unless it is disabled by WithRequestCoalescing.
+// session is the session preferred for the request, the requests of different sessions
+// are never coalesced.
+func (p *PixivClient) getRawDate(ctx context.Context, endpoint, url, refer string, session *pooledSession) ([]byte, error) {
+	if p.flights == nil {
+		return p.readRawDate(ctx, endpoint, url, refer)
+	}
+	body, _, err := p.flights.Do(ctx, p.flightKey(ctx, endpoint, url, refer, session), func(ctx context.Context) ([]byte, error) {
+		return p.readRawDate(ctx, endpoint, url, refer)
+	})
+	return body, err
 }
 
-func (p *PixivClient) getRawDate(url, refer string) ([]byte, error) {
-	resp, err := p.getRaw(url, refer)
+func (p *PixivClient) readRawDate(ctx context.Context, endpoint, url, refer string) ([]byte, error) {
+	resp, err := p.getRaw(ctx, endpoint, url, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -157,21 +436,41 @@ func (p *PixivClient) getRawDate(url, refer string) ([]byte, error) {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 	return body, nil
 }
 
-func (p *PixivClient) getPixivResp(urlStr, refer string) (*PixivResponse, error) {
+func (p *PixivClient) getPixivResp(ctx context.Context, endpoint, urlStr, refer string) (*PixivResponse, error) {
 	pUrl, err := url.Parse(urlStr)
 	if err != nil {
 		return nil, err
 	}
 	params := pUrl.Query()
-	params.Add("lang", p.Lang)
+	if !params.Has("lang") {
+		params.Set("lang", p.requestLang(ctx))
+	}
 	pUrl.RawQuery = params.Encode()
 
-	body, err := p.getRawDate(pUrl.String(), refer)
+	urlStr = pUrl.String()
+
+	ctx, holder := withPickedSessionHolder(ctx)
+	preferred := p.preferSession(ctx, holder)
+
+	ttl := p.cacheTTL(endpoint)
+	if ttl > 0 {
+		if body, ok := p.cache.Get(p.cacheKey(ctx, endpoint, urlStr, preferred)); ok {
+			var pResp PixivResponse
+			if err := json.Unmarshal(body, &pResp); err == nil && !pResp.Error {
+				return &pResp, nil
+			}
+		}
+	}
+
+	body, err := p.getRawDate(ctx, endpoint, urlStr, refer, preferred)
 	if err != nil {
 		return nil, err
 	}
@@ -179,23 +478,87 @@ func (p *PixivClient) getPixivResp(urlStr, refer string) (*PixivResponse, error)
 	var pResp PixivResponse
 	err = json.Unmarshal(body, &pResp)
 	if err != nil {
+		p.sessions.report(holder.get(), nil)
 		return nil, NewJsonUnmarshalErr(body, err)
 	}
 	if pResp.Error {
-		return nil, errors.New(fmt.Sprintf("Pixiv response error: %s", pResp.Message))
+		apiErr := &PixivAPIError{Message: pResp.Message, URL: urlStr}
+		if errors.Is(apiErr, ErrLoginRequired) {
+			p.sessions.report(holder.get(), apiErr)
+		} else {
+			p.sessions.report(holder.get(), nil)
+		}
+		return nil, apiErr
 	}
+	session := holder.get()
+	p.sessions.report(session, nil)
 
+	// the response is cached by the session actually used, which may be another one than
+	// the preferred if retried, the coalesced callers leave it to the caller sent the request
+	if ttl > 0 && (p.sessions == nil || session != nil) {
+		p.cache.Set(p.cacheKey(ctx, endpoint, urlStr, session), body, ttl)
+	}
 	return &pResp, nil
 }
 
+// ajaxPath add the leading slash to the path if missing, so it can be appended to the base url
+func ajaxPath(path string) string {
+	if len(path) == 0 || strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/" + path
+}
+
+// GetAjax call the ajax api path of the Web base url which is not wrapped by the client,
+// e.g. "/ajax/illust/102050100/recommend/init", refer is the path of the Referer. The lang,
+// headers and cookies of the client apply, the pixiv error is returned as *PixivAPIError
+// and the body of the pixiv response is decoded into out unless it is nil.
+func (p *PixivClient) GetAjax(path string, params url.Values, refer string, out any) error {
+	return p.GetAjaxWithContext(context.Background(), path, params, refer, out)
+}
+
+// GetAjaxWithContext is like GetAjax but with a context
+func (p *PixivClient) GetAjaxWithContext(ctx context.Context, path string, params url.Values, refer string, out any) error {
+	baseUrls := p.BaseUrls()
+	aUrl, err := url.Parse(baseUrls.Web + ajaxPath(path))
+	if err != nil {
+		return err
+	}
+	query := aUrl.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			query.Add(k, v)
+		}
+	}
+	aUrl.RawQuery = query.Encode()
+
+	resp, err := p.getPixivResp(ctx, EndpointAjaxGet, aUrl.String(), baseUrls.Web+ajaxPath(refer))
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return NewJsonUnmarshalErr(resp.Body, err)
+	}
+	return nil
+}
+
 // GetUserBookmarks get the bookmarks info of a user
 func (p *PixivClient) GetUserBookmarks(uid string, offset, limit int32) (*BookmarksInfo, error) {
-	bUrl, err := genPageUrl(uid, offset, limit, pageUrlTypeBookmarks)
+	return p.GetUserBookmarksWithContext(context.Background(), uid, offset, limit)
+}
+
+// GetUserBookmarksWithContext is like GetUserBookmarks but with a context
+func (p *PixivClient) GetUserBookmarksWithContext(ctx context.Context, uid string, offset, limit int32) (*BookmarksInfo, error) {
+	baseUrls := p.BaseUrls()
+	bUrl, err := genPageUrl(baseUrls, uid, offset, limit, pageUrlTypeBookmarks)
 	if err != nil {
 		return nil, err
 	}
-	refer := fmt.Sprintf(userBookmarksReferUrl, uid)
-	resp, err := p.getPixivResp(bUrl, refer)
+	refer := baseUrls.webUrl(userBookmarksReferPath, uid)
+	resp, err := p.getPixivResp(ctx, EndpointUserBookmarks, bUrl, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -210,12 +573,18 @@ func (p *PixivClient) GetUserBookmarks(uid string, offset, limit int32) (*Bookma
 
 // GetUserFollowing get the following info of a user
 func (p *PixivClient) GetUserFollowing(uid string, offset, limit int32) (*FollowingInfo, error) {
-	fUrl, err := genPageUrl(uid, offset, limit, pageUrlTypeFollowing)
+	return p.GetUserFollowingWithContext(context.Background(), uid, offset, limit)
+}
+
+// GetUserFollowingWithContext is like GetUserFollowing but with a context
+func (p *PixivClient) GetUserFollowingWithContext(ctx context.Context, uid string, offset, limit int32) (*FollowingInfo, error) {
+	baseUrls := p.BaseUrls()
+	fUrl, err := genPageUrl(baseUrls, uid, offset, limit, pageUrlTypeFollowing)
 	if err != nil {
 		return nil, err
 	}
-	refer := fmt.Sprintf(userFollowingReferUrl, uid)
-	resp, err := p.getPixivResp(fUrl, refer)
+	refer := baseUrls.webUrl(userFollowingReferPath, uid)
+	resp, err := p.getPixivResp(ctx, EndpointUserFollowing, fUrl, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -230,9 +599,15 @@ func (p *PixivClient) GetUserFollowing(uid string, offset, limit int32) (*Follow
 
 // GetUserIllusts get all illusts of the user
 func (p *PixivClient) GetUserIllusts(uid string) ([]PixivID, error) {
-	iUrl := fmt.Sprintf(userIllustUrl, uid)
-	refer := fmt.Sprintf(userIllustReferUrl, uid)
-	resp, err := p.getPixivResp(iUrl, refer)
+	return p.GetUserIllustsWithContext(context.Background(), uid)
+}
+
+// GetUserIllustsWithContext is like GetUserIllusts but with a context
+func (p *PixivClient) GetUserIllustsWithContext(ctx context.Context, uid string) ([]PixivID, error) {
+	baseUrls := p.BaseUrls()
+	iUrl := baseUrls.webUrl(userIllustPath, uid)
+	refer := baseUrls.webUrl(userIllustReferPath, uid)
+	resp, err := p.getPixivResp(ctx, EndpointUserIllusts, iUrl, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -263,21 +638,28 @@ func (p *PixivClient) GetUserIllusts(uid string) ([]PixivID, error) {
 // GetIllustInfo get the illust detail for the illust id. For a multi page illust,
 // only the first page will be fetched if onlyP0 is true.
 func (p *PixivClient) GetIllustInfo(illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
-	illust, err := p.getBasicIllustInfo(illustId)
+	return p.GetIllustInfoWithContext(context.Background(), illustId, onlyP0)
+}
+
+// GetIllustInfoWithContext is like GetIllustInfo but with a context, the context
+// is shared by the basic info request and the pages request.
+func (p *PixivClient) GetIllustInfoWithContext(ctx context.Context, illustId PixivID, onlyP0 bool) ([]*IllustInfo, error) {
+	illust, err := p.getBasicIllustInfo(ctx, illustId)
 	if err != nil {
 		return nil, err
 	}
 	if illust.PageCount == 1 || onlyP0 {
 		return []*IllustInfo{illust}, nil
 	} else {
-		return p.getMultiPagesIllustInfo(illust)
+		return p.getMultiPagesIllustInfo(ctx, illust)
 	}
 }
 
-func (p *PixivClient) getBasicIllustInfo(illustId PixivID) (*IllustInfo, error) {
-	illustUrl := fmt.Sprintf(illustInfoUrl, illustId)
-	refer := fmt.Sprintf(illustInfoReferUrl, illustId)
-	iResp, err := p.getPixivResp(illustUrl, refer)
+func (p *PixivClient) getBasicIllustInfo(ctx context.Context, illustId PixivID) (*IllustInfo, error) {
+	baseUrls := p.BaseUrls()
+	illustUrl := baseUrls.webUrl(illustInfoPath, illustId)
+	refer := baseUrls.webUrl(illustInfoReferPath, illustId)
+	iResp, err := p.getPixivResp(ctx, EndpointIllustInfo, illustUrl, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -351,10 +733,11 @@ func (p *PixivClient) getBasicIllustInfo(illustId PixivID) (*IllustInfo, error)
 	return illust.IllustInfo, nil
 }
 
-func (p *PixivClient) getMultiPagesIllustInfo(seed *IllustInfo) ([]*IllustInfo, error) {
-	illustUrl := fmt.Sprintf(illustPagesUrl, seed.Id)
-	refer := fmt.Sprintf(illustInfoReferUrl, seed.Id)
-	iResp, err := p.getPixivResp(illustUrl, refer)
+func (p *PixivClient) getMultiPagesIllustInfo(ctx context.Context, seed *IllustInfo) ([]*IllustInfo, error) {
+	baseUrls := p.BaseUrls()
+	illustUrl := baseUrls.webUrl(illustPagesPath, seed.Id)
+	refer := baseUrls.webUrl(illustInfoReferPath, seed.Id)
+	iResp, err := p.getPixivResp(ctx, EndpointIllustPages, illustUrl, refer)
 	if err != nil {
 		return nil, err
 	}
@@ -382,8 +765,181 @@ func (p *PixivClient) getMultiPagesIllustInfo(seed *IllustInfo) ([]*IllustInfo,
 	return illusts, nil
 }
 
+// GetSelfInfo get the logged-in user of the session, ErrLoginRequired is returned if the
+// cookie is missing or expired. It can be used as a preflight check before long crawls.
+func (p *PixivClient) GetSelfInfo() (*SelfInfo, error) {
+	return p.GetSelfInfoWithContext(context.Background())
+}
+
+// GetSelfInfoWithContext is like GetSelfInfo but with a context
+func (p *PixivClient) GetSelfInfoWithContext(ctx context.Context) (*SelfInfo, error) {
+	baseUrls := p.BaseUrls()
+	resp, err := p.getPixivResp(ctx, EndpointSelfStatus, baseUrls.Web+selfStatusPath, baseUrls.Web)
+	if err != nil {
+		return nil, err
+	}
+
+	/**
+	The json format of body:
+
+	"user_status": {
+	    "user_id": "4495110",
+	    "user_name": "name",
+	    "user_account": "account",
+	    "is_logged_in": true,
+	    "is_premium": false,
+	    "user_x_restrict": 2
+	}
+	*/
+	var body struct {
+		UserStatus struct {
+			UserId        PixivID        `json:"user_id"`
+			UserName      string         `json:"user_name"`
+			UserAccount   string         `json:"user_account"`
+			IsLoggedIn    bool           `json:"is_logged_in"`
+			IsPremium     bool           `json:"is_premium"`
+			UserXRestrict XRestrictLevel `json:"user_x_restrict"`
+		} `json:"user_status"`
+	}
+	err = json.Unmarshal(resp.Body, &body)
+	if err != nil {
+		return nil, NewJsonUnmarshalErr(resp.Body, err)
+	}
+	status := body.UserStatus
+	if !status.IsLoggedIn || len(status.UserId) == 0 || status.UserId == "0" {
+		return nil, ErrLoginRequired
+	}
+
+	return &SelfInfo{
+		UserInfo: UserInfo{
+			UserId:      status.UserId,
+			UserName:    status.UserName,
+			UserAccount: status.UserAccount,
+		},
+		Premium:   status.IsPremium,
+		XRestrict: status.UserXRestrict,
+		ShowR18:   status.UserXRestrict >= XRestrictLevelR18,
+		ShowR18G:  status.UserXRestrict >= XRestrictLevelR18G,
+	}, nil
+}
+
+// GetUserInfo get the id and name of a user, use GetUserProfile for the other fields of the
+// profile. full is kept for compatibility, it does not change the returned fields.
 func (p *PixivClient) GetUserInfo(uid string, full bool) (*UserInfo, error) {
-	return nil, errors.New("not supported")
+	return p.GetUserInfoWithContext(context.Background(), uid, full)
+}
+
+// GetUserInfoWithContext is like GetUserInfo but with a context
+func (p *PixivClient) GetUserInfoWithContext(ctx context.Context, uid string, full bool) (*UserInfo, error) {
+	profile, err := p.GetUserProfileWithContext(ctx, uid, full)
+	if err != nil {
+		return nil, err
+	}
+	return &profile.UserInfo, nil
+}
+
+// GetUserProfile get the profile of a user, the fields after IsFollowed are only filled if full is true
+func (p *PixivClient) GetUserProfile(uid string, full bool) (*UserProfile, error) {
+	return p.GetUserProfileWithContext(context.Background(), uid, full)
+}
+
+// GetUserProfileWithContext is like GetUserProfile but with a context
+func (p *PixivClient) GetUserProfileWithContext(ctx context.Context, uid string, full bool) (*UserProfile, error) {
+	baseUrls := p.BaseUrls()
+	uUrl := baseUrls.webUrl(userInfoPath, uid)
+	if full {
+		uUrl += "?full=1"
+	}
+	refer := baseUrls.webUrl(userIllustReferPath, uid)
+	resp, err := p.getPixivResp(ctx, EndpointUserInfo, uUrl, refer)
+	if err != nil {
+		return nil, err
+	}
+
+	/**
+	The json format of body, the fields after isFollowed only exist in the full mode:
+
+	{
+	    "userId": "4495110",
+	    "name": "name",
+	    "image": "https://i.pximg.net/user-profile/img/.../xxx_50.jpg",
+	    "imageBig": "https://i.pximg.net/user-profile/img/.../xxx_170.jpg",
+	    "premium": false,
+	    "isFollowed": false,
+	    "background": {"url": "https://i.pximg.net/background/img/...", ...} or null,
+	    "following": 100,
+	    "mypixivCount": 10,
+	    "comment": "bio",
+	    "webpage": "https://...",
+	    "social": {"twitter": {"url": "https://twitter.com/..."}} or [],
+	    "region": {"name": "Japan", "privacyLevel": "0", ...},
+	    "birthDay": {"name": "01月01日", "privacyLevel": "0"},
+	    ...
+	}
+	*/
+	type privacyField struct {
+		Name         string          `json:"name"`
+		PrivacyLevel json.RawMessage `json:"privacyLevel"`
+	}
+	var body struct {
+		UserId     PixivID `json:"userId"`
+		Name       string  `json:"name"`
+		Image      string  `json:"image"`
+		ImageBig   string  `json:"imageBig"`
+		Premium    bool    `json:"premium"`
+		IsFollowed bool    `json:"isFollowed"`
+		Background *struct {
+			Url string `json:"url"`
+		} `json:"background"`
+		Following    int             `json:"following"`
+		MypixivCount int             `json:"mypixivCount"`
+		Comment      string          `json:"comment"`
+		Webpage      string          `json:"webpage"`
+		Social       json.RawMessage `json:"social"`
+		Region       *privacyField   `json:"region"`
+		BirthDay     *privacyField   `json:"birthDay"`
+	}
+	err = json.Unmarshal(resp.Body, &body)
+	if err != nil {
+		return nil, NewJsonUnmarshalErr(resp.Body, err)
+	}
+
+	profile := &UserProfile{
+		UserInfo:     UserInfo{UserId: body.UserId, UserName: body.Name},
+		Image:        body.Image,
+		ImageBig:     body.ImageBig,
+		Premium:      body.Premium,
+		IsFollowed:   body.IsFollowed,
+		Following:    body.Following,
+		MypixivCount: body.MypixivCount,
+		Comment:      body.Comment,
+		Webpage:      body.Webpage,
+	}
+	if body.Background != nil {
+		profile.Background = body.Background.Url
+	}
+	// the social is an empty list if the user has no social link
+	if len(body.Social) > 0 && body.Social[0] == '{' {
+		var social map[string]struct {
+			Url string `json:"url"`
+		}
+		if err := json.Unmarshal(body.Social, &social); err != nil {
+			return nil, NewJsonUnmarshalErr(resp.Body, err)
+		}
+		profile.Social = make(map[string]string, len(social))
+		for name, link := range social {
+			profile.Social[name] = link.Url
+		}
+	}
+	if body.Region != nil {
+		profile.Region = body.Region.Name
+	}
+	if body.BirthDay != nil {
+		profile.Birthday = body.BirthDay.Name
+		level := strings.Trim(string(body.BirthDay.PrivacyLevel), `"`)
+		profile.BirthdayVisible = len(body.BirthDay.Name) > 0 && level == "0"
+	}
+	return profile, nil
 }
 
 func (p *PixivClient) IllustSearch() ([]*IllustInfo, error) {
@@ -392,7 +948,13 @@ func (p *PixivClient) IllustSearch() ([]*IllustInfo, error) {
 
 // IllustRank get the illust rank, date	format: 20230118
 func (p *PixivClient) IllustRank(mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error) {
-	irUrl, _ := url.Parse(illustRankUrl)
+	return p.IllustRankWithContext(context.Background(), mode, content, date, page)
+}
+
+// IllustRankWithContext is like IllustRank but with a context
+func (p *PixivClient) IllustRankWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent, date string, page int) (*IllustRankInfo, error) {
+	baseUrls := p.BaseUrls()
+	irUrl, _ := url.Parse(baseUrls.Rank + illustRankPath)
 	params := irUrl.Query()
 	params.Set("mode", string(mode))
 	params.Set("content", string(content))
@@ -402,18 +964,20 @@ func (p *PixivClient) IllustRank(mode IllustRankMode, content IllustRankContent,
 	if page > 0 {
 		params.Set("p", strconv.FormatInt(int64(page), 10))
 	}
-	if len(p.Lang) > 0 {
-		params.Set("lang", p.Lang)
+	if lang := p.requestLang(ctx); len(lang) > 0 {
+		params.Set("lang", lang)
 	}
 
 	params.Set("format", "json")
 	irUrl.RawQuery = params.Encode()
 	urlStr := irUrl.String()
 
-	body, err := p.getRawDate(urlStr, urlStr)
+	ctx, holder := withPickedSessionHolder(ctx)
+	body, err := p.getRawDate(ctx, EndpointIllustRank, urlStr, urlStr, p.preferSession(ctx, holder))
 	if err != nil {
 		return nil, err
 	}
+	p.sessions.report(holder.get(), nil)
 
 	var illustRank IllustRankInfo
 	err = json.Unmarshal(body, &illustRank)
@@ -427,21 +991,41 @@ func (p *PixivClient) IllustRankToday(mode IllustRankMode, content IllustRankCon
 	return p.IllustRank(mode, content, "", page)
 }
 
+func (p *PixivClient) IllustRankTodayWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent, page int) (*IllustRankInfo, error) {
+	return p.IllustRankWithContext(ctx, mode, content, "", page)
+}
+
 func (p *PixivClient) IllustRankTodayFirstPage(mode IllustRankMode, content IllustRankContent) (*IllustRankInfo, error) {
 	return p.IllustRank(mode, content, "", 0)
 }
 
+func (p *PixivClient) IllustRankTodayFirstPageWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent) (*IllustRankInfo, error) {
+	return p.IllustRankWithContext(ctx, mode, content, "", 0)
+}
+
 func (p *PixivClient) GetIllust(url string) (io.ReadCloser, error) {
-	resp, err := p.getRaw(url, illustDownloadReferUrl)
+	return p.GetIllustWithContext(context.Background(), url)
+}
+
+// GetIllustWithContext is like GetIllust but with a context, reading the returned
+// body will fail with ctx.Err() once the context is done.
+func (p *PixivClient) GetIllustWithContext(ctx context.Context, url string) (io.ReadCloser, error) {
+	baseUrls := p.BaseUrls()
+	resp, err := p.getRaw(ctx, EndpointIllustDownload, baseUrls.imageUrl(url), baseUrls.Web)
 	if err != nil {
 		return nil, err
 	}
-	return resp.Body, nil
+	return &contextReadCloser{ctx: ctx, rc: resp.Body}, nil
 }
 
 // GetIllustData will read all the illust bytes, may be OOM
 func (p *PixivClient) GetIllustData(url string) ([]byte, error) {
-	resp, err := p.GetIllust(url)
+	return p.GetIllustDataWithContext(context.Background(), url)
+}
+
+// GetIllustDataWithContext is like GetIllustData but with a context
+func (p *PixivClient) GetIllustDataWithContext(ctx context.Context, url string) ([]byte, error) {
+	resp, err := p.GetIllustWithContext(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -458,7 +1042,14 @@ func (p *PixivClient) GetIllustData(url string) ([]byte, error) {
 
 // DownloadIllust download the illust to filename, return the file size and sha1 sum
 func (p *PixivClient) DownloadIllust(url, filename string) (int64, string, error) {
-	resp, err := p.getRaw(url, illustDownloadReferUrl)
+	return p.DownloadIllustWithContext(context.Background(), url, filename)
+}
+
+// DownloadIllustWithContext is like DownloadIllust but with a context, the download
+// will be aborted and ctx.Err() returned once the context is done.
+func (p *PixivClient) DownloadIllustWithContext(ctx context.Context, url, filename string) (int64, string, error) {
+	baseUrls := p.BaseUrls()
+	resp, err := p.getRaw(ctx, EndpointIllustDownload, baseUrls.imageUrl(url), baseUrls.Web)
 	if err != nil {
 		return 0, "", err
 	}
@@ -466,7 +1057,7 @@ func (p *PixivClient) DownloadIllust(url, filename string) (int64, string, error
 		_ = resp.Body.Close()
 	}()
 
-	return WriteFIleCalSha1(resp.Body, filename)
+	return WriteFIleCalSha1(&contextReadCloser{ctx: ctx, rc: resp.Body}, filename)
 }
 
 // IllustRankIter iterate the rank every page.
@@ -482,6 +1073,7 @@ func (p *PixivClient) DownloadIllust(url, filename string) (int64, string, error
 //			fmt.Println(iter.Error())
 //	}
 type IllustRankIter struct {
+	ctx      context.Context
 	client   *PixivClient
 	curValue *IllustRankInfo
 	curIdx   int
@@ -511,7 +1103,7 @@ func (r IllustRankIter) Next() {
 		return
 	}
 
-	illustRank, err := r.client.IllustRank(r.curValue.Mode, r.curValue.Content, string(r.curValue.Date), int(r.curValue.Next))
+	illustRank, err := r.client.IllustRankWithContext(r.ctx, r.curValue.Mode, r.curValue.Content, string(r.curValue.Date), int(r.curValue.Next))
 	if err != nil {
 		r.err = err
 		return
@@ -526,12 +1118,19 @@ func (r IllustRankIter) Value() *IllustRankItem {
 
 // ScanIllustRank get an illust rank iterator, you don't need process the page yourself
 func (p *PixivClient) ScanIllustRank(mode IllustRankMode, content IllustRankContent, date string) (IllustRankIter, error) {
-	illustRankInfo, err := p.IllustRank(mode, content, date, 1)
+	return p.ScanIllustRankWithContext(context.Background(), mode, content, date)
+}
+
+// ScanIllustRankWithContext is like ScanIllustRank but with a context, the context
+// is also used by the iterator when fetching the next pages.
+func (p *PixivClient) ScanIllustRankWithContext(ctx context.Context, mode IllustRankMode, content IllustRankContent, date string) (IllustRankIter, error) {
+	illustRankInfo, err := p.IllustRankWithContext(ctx, mode, content, date, 1)
 	if err != nil {
 		return IllustRankIter{}, err
 	}
 
 	iter := IllustRankIter{
+		ctx:      ctx,
 		client:   p,
 		curValue: illustRankInfo,
 		curIdx:   0,
@@ -1,13 +1,48 @@
 package pixiv_api_go
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 // var Cookie = ""
 var userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/108.0.0.0 Safari/537.36"
 
+// newFixtureClient return a client replaying testdata/<test name>.json, or recording it
+// from pixiv if PIXIV_RECORD is set. The test is skipped if the fixture is missing.
+func newFixtureClient(t *testing.T, timeoutMs int32) *PixivClient {
+	fixture := filepath.Join("testdata", t.Name()+".json")
+	if len(os.Getenv("PIXIV_RECORD")) > 0 {
+		rec, err := NewRecorder(fixture, RecordModeRecord, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := rec.Save(); err != nil {
+				t.Error(err)
+			}
+		})
+		return NewPixivClientWithOptions(WithTimeout(time.Duration(timeoutMs)*time.Millisecond), WithTransport(rec))
+	}
+	if _, err := os.Stat(fixture); err != nil {
+		t.Skipf("no fixture %s, record it with PIXIV_RECORD=1", fixture)
+	}
+	rec, err := NewRecorder(fixture, RecordModeReplayStrict, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPixivClientWithOptions(WithTimeout(time.Duration(timeoutMs)*time.Millisecond), WithTransport(rec))
+}
+
 func TestPixivID(t *testing.T) {
 	js := `{"id": 123456789}`
 	var id struct {
@@ -18,6 +53,23 @@ func TestPixivID(t *testing.T) {
 		t.Fatal(err)
 	}
 	t.Log(id.Id)
+
+	var testCase = []struct {
+		js       string
+		expected PixivID
+		err      bool
+	}{
+		{`{"id": "123456789"}`, "123456789", false},
+		{`{"id": ""}`, "", false},
+		{`{"id": "abc"}`, "", true},
+	}
+	for _, tc := range testCase {
+		id.Id = ""
+		err := json.Unmarshal([]byte(tc.js), &id)
+		if (err != nil) != tc.err || id.Id != tc.expected {
+			t.Errorf("%s, expected: %q, acture: %q, err: %v", tc.js, tc.expected, id.Id, err)
+		}
+	}
 }
 
 func TestUserBookmarks(t *testing.T) {
@@ -42,7 +94,7 @@ func TestUserBookmarks(t *testing.T) {
 }
 
 func TestGetIllustInfo(t *testing.T) {
-	client := NewPixivClient(5000)
+	client := newFixtureClient(t, 5000)
 	client.SetUserAgent(userAgent)
 
 	var testCase = []struct {
@@ -64,7 +116,7 @@ func TestGetIllustInfo(t *testing.T) {
 }
 
 func TestIllustRank(t *testing.T) {
-	client := NewPixivClient(5000)
+	client := newFixtureClient(t, 5000)
 	//client.SetCookiePHPSESSID(Cookie)
 	//client.SetUserAgent(userAgent)
 
@@ -105,7 +157,7 @@ func TestIllustRank(t *testing.T) {
 }
 
 func TestIllustInfo(t *testing.T) {
-	client := NewPixivClient(5000)
+	client := newFixtureClient(t, 5000)
 	//client.SetCookiePHPSESSID(Cookie)
 	//client.SetUserAgent(userAgent)
 
@@ -138,7 +190,7 @@ func TestIllustInfo(t *testing.T) {
 }
 
 func TestDownload(t *testing.T) {
-	client := NewPixivClient(60000)
+	client := newFixtureClient(t, 60000)
 	filename := "/tmp/pixiv-api/1.jpg"
 	_, hash, err := client.DownloadIllust("https://i.pximg.net/img-original/img/2022/12/24/00/00/46/103842593_p0.jpg", filename)
 	if err != nil {
@@ -153,3 +205,366 @@ func TestDownload(t *testing.T) {
 		t.Errorf("expected: %s, acture: %s", hash, actualHash)
 	}
 }
+
+func TestDownloadContextCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 100; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+			_, _ = w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	client := NewPixivClient(60000)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	filename := filepath.Join(t.TempDir(), "1.jpg")
+	_, _, err := client.DownloadIllustWithContext(ctx, server.URL+"/1.jpg", filename)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected: %v, acture: %v", context.DeadlineExceeded, err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("download not aborted promptly, cost: %s", time.Since(start))
+	}
+}
+
+func TestBaseUrls(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ajax/illust/123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Referer() != "http://"+r.Host+"/artworks/123" {
+			t.Errorf("unexpected referer: %s", r.Referer())
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"id":"123","title":"t","pageCount":1,"tags":{"tags":[{"tag":"R-18"}]}}}`))
+	})
+	mux.HandleFunc("/mirror/img-original/img/1_p0.jpg", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("image"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewPixivClient(5000)
+	client.SetBaseUrls(BaseUrls{Web: server.URL, Rank: server.URL, Image: server.URL + "/mirror"})
+
+	illusts, err := client.GetIllustInfo("123", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(illusts) != 1 || !illusts[0].R18 {
+		t.Errorf("unexpected illust: %+v", illusts)
+	}
+
+	data, err := client.GetIllustData("https://i.pximg.net/img-original/img/1_p0.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "image" {
+		t.Errorf("expected: image, acture: %s", data)
+	}
+}
+
+func TestNewPixivClientWithOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != userAgent {
+			t.Errorf("unexpected user agent: %s", r.UserAgent())
+		}
+		if c, err := r.Cookie("PHPSESSID"); err != nil || c.Value != "session" {
+			t.Errorf("unexpected cookie: %v, err: %v", c, err)
+		}
+		if lang := r.URL.Query().Get("lang"); lang != "en" {
+			t.Errorf("unexpected lang: %s", lang)
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(
+		WithTimeout(5*time.Second),
+		WithUserAgent(userAgent),
+		WithCookiePHPSESSID("session"),
+		WithLang("en"),
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithTransportConfig(func(tr *http.Transport) { tr.MaxIdleConnsPerHost = 8 }),
+	)
+	illusts, err := client.GetUserIllusts("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(illusts) != 0 {
+		t.Errorf("expected no illust, acture: %v", illusts)
+	}
+}
+
+func TestDeprecatedFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != userAgent {
+			t.Errorf("unexpected user agent: %s", r.UserAgent())
+		}
+		if c, err := r.Cookie("PHPSESSID"); err != nil || c.Value != "session" {
+			t.Errorf("unexpected cookie: %v, err: %v", c, err)
+		}
+		if lang := r.URL.Query().Get("lang"); lang != "en" {
+			t.Errorf("unexpected lang: %s", lang)
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}))
+	client.Header = map[string]string{"User-Agent": userAgent}
+	client.Cookie["PHPSESSID"] = "session"
+	client.Lang = "en"
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if client.GetLang() != "en" || client.GetHeader()["User-Agent"] != userAgent {
+		t.Errorf("unexpected lang: %s, header: %v", client.GetLang(), client.GetHeader())
+	}
+
+	client.SetLang("ja")
+	if client.Lang != "ja" {
+		t.Errorf("expected lang ja, acture: %s", client.Lang)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ajax/user/1/profile/all", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("slow down"))
+	})
+	mux.HandleFunc("/ajax/user/2/profile/all", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":true,"message":"Please login","body":[]}`))
+	})
+	mux.HandleFunc("/ajax/user/3/profile/all", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":1}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}))
+
+	_, err := client.GetUserIllusts("1")
+	var httpErr *HTTPError
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &httpErr) {
+		t.Fatalf("expected rate limited http error, acture: %v", err)
+	}
+	if httpErr.StatusCode != http.StatusTooManyRequests || httpErr.Body != "slow down" {
+		t.Errorf("unexpected http error: %+v", httpErr)
+	}
+
+	_, err = client.GetUserIllusts("2")
+	var apiErr *PixivAPIError
+	if !errors.Is(err, ErrLoginRequired) || !errors.As(err, &apiErr) || apiErr.Message != "Please login" {
+		t.Errorf("expected login required api error, acture: %v", err)
+	}
+
+	_, err = client.GetUserIllusts("4")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected: %v, acture: %v", ErrNotFound, err)
+	}
+
+	_, err = client.GetUserIllusts("3")
+	var jsonErr *ErrorJsonUnmarshal
+	if !errors.As(err, &jsonErr) || errors.Unwrap(err) == nil {
+		t.Errorf("expected json unmarshal error, acture: %v", err)
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		if r.Header.Get("X-Override") == "1" && (c == nil || c.Value != "other" || r.URL.Query().Get("lang") != "ja") {
+			t.Errorf("request options not applied, cookie: %v, lang: %s", c, r.URL.Query().Get("lang"))
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithCookiePHPSESSID("session"))
+	ctx := ContextWithRequestOptions(context.Background(), RequestOptions{
+		Header: map[string]string{"X-Override": "1"},
+		Cookie: map[string]string{"PHPSESSID": "other"},
+	})
+	ctx = ContextWithRequestOptions(ctx, RequestOptions{Lang: "ja"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			client.AddCookie("PHPSESSID", "session")
+			client.SetUserAgent(userAgent)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := client.GetUserIllustsWithContext(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetUserIllusts("1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	if client.GetCookie()["PHPSESSID"] != "session" {
+		t.Errorf("client cookie changed by request options: %v", client.GetCookie())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Sign") != "signed" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(endpoint string, req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+":"+endpoint)
+				return next(endpoint, req)
+			}
+		}
+	}
+	sign := func(next Handler) Handler {
+		return func(endpoint string, req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Sign", "signed")
+			return next(endpoint, req)
+		}
+	}
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithMiddleware(record("a"), record("b"), sign))
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0] != "a:"+EndpointUserIllusts || calls[1] != "b:"+EndpointUserIllusts {
+		t.Errorf("unexpected middleware calls: %v", calls)
+	}
+}
+
+func TestGetSelfInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, _ := r.Cookie("PHPSESSID"); c != nil && c.Value == "valid" {
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"user_status":{"user_id":"4495110","user_name":"neko","user_account":"littleneko","is_logged_in":true,"is_premium":true,"user_x_restrict":1}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"user_status":{"is_logged_in":false}}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}))
+	if _, err := client.GetSelfInfo(); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("expected: %v, acture: %v", ErrLoginRequired, err)
+	}
+
+	client.SetCookiePHPSESSID("valid")
+	self, err := client.GetSelfInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.UserId != "4495110" || self.UserName != "neko" || !self.Premium || !self.ShowR18 || self.ShowR18G {
+		t.Errorf("unexpected self info: %+v", self)
+	}
+}
+
+func TestGetAjax(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		// the lang param given by the caller overrides the client lang
+		lang := map[string]string{"/ajax/illust/1/recommend/init": "ja"}[r.URL.Path]
+		if lang == "" {
+			lang = "en"
+		}
+		if c == nil || c.Value != "session" || len(r.URL.Query()["lang"]) != 1 || r.URL.Query().Get("lang") != lang || r.Header.Get("Referer") != "http://"+r.Host+"/artworks/1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/ajax/illust/1/recommend/init":
+			_, _ = fmt.Fprintf(w, `{"error":false,"message":"","body":{"illusts":[{"id":"2"}],"limit":"%s"}}`, r.URL.Query().Get("limit"))
+		default:
+			_, _ = w.Write([]byte(`{"error":true,"message":"unknown endpoint","body":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithCookiePHPSESSID("session"), WithLang("en"))
+	var recommend struct {
+		Illusts []IllustDigest `json:"illusts"`
+		Limit   string         `json:"limit"`
+	}
+	if err := client.GetAjax("ajax/illust/1/recommend/init", url.Values{"limit": {"18"}, "lang": {"ja"}}, "artworks/1", &recommend); err != nil {
+		t.Fatal(err)
+	}
+	if len(recommend.Illusts) != 1 || recommend.Illusts[0].Id != "2" || recommend.Limit != "18" {
+		t.Errorf("unexpected body: %+v", recommend)
+	}
+
+	err := client.GetAjax("/ajax/unknown", nil, "/artworks/1", nil)
+	if apiErr, ok := err.(*PixivAPIError); !ok || apiErr.Message != "unknown endpoint" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestGetUserProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ajax/user/1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("full") != "1" {
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"userId":"1","name":"neko","image":"i50","imageBig":"i170",
+"premium":true,"isFollowed":true,"background":null,"social":[]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"userId":"1","name":"neko","image":"i50","imageBig":"i170",
+"premium":true,"isFollowed":true,"background":{"repeat":null,"color":null,"url":"bg","isPrivate":false},
+"following":100,"mypixivCount":10,"comment":"hello","webpage":"https://example.com",
+"social":{"twitter":{"url":"https://twitter.com/neko"},"instagram":{"url":"https://instagram.com/neko"}},
+"region":{"name":"Japan","region":"JP","prefecture":"13","privacyLevel":"0"},
+"birthDay":{"name":"01月01日","privacyLevel":"0"},"gender":{"name":null,"privacyLevel":null}}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}))
+	user, err := client.GetUserProfile("1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.UserId != "1" || user.UserName != "neko" || user.ImageBig != "i170" || !user.Premium || !user.IsFollowed ||
+		user.Social != nil || user.Following != 0 {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	user, err = client.GetUserProfile("1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Background != "bg" || user.Following != 100 || user.MypixivCount != 10 || user.Comment != "hello" ||
+		user.Social["twitter"] != "https://twitter.com/neko" || user.Region != "Japan" || !user.BirthdayVisible {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	if _, err := client.GetUserProfile("2", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected: %v, acture: %v", ErrNotFound, err)
+	}
+
+	info, err := client.GetUserInfo("1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserId != "1" || info.UserName != "neko" {
+		t.Errorf("unexpected user: %+v", info)
+	}
+}
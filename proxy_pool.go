@@ -0,0 +1,292 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxySelectStrategy decide which healthy proxy of the pool is used for a request
+type ProxySelectStrategy int
+
+const (
+	// ProxyRoundRobin use the healthy proxies in turn
+	ProxyRoundRobin ProxySelectStrategy = iota
+	// ProxyLeastFailures use the healthy proxy with the fewest failures
+	ProxyLeastFailures
+)
+
+// DefaultProxyCheckUrl is the url requested through the proxies by the health check
+const DefaultProxyCheckUrl = "https://www.pixiv.net/"
+
+// ProxyHealth is the health report of a proxy in the pool
+type ProxyHealth struct {
+	URL                 string
+	Healthy             bool
+	Requests            int64
+	Failures            int64
+	ConsecutiveFailures int64
+	LastError           string
+	LastCheck           time.Time
+}
+
+type proxyState struct {
+	url    *url.URL
+	health ProxyHealth
+}
+
+// ProxyPool select a proxy for every request, the proxy failing MaxFailures times in a row
+// is taken out of rotation until a health check succeeds
+type ProxyPool struct {
+	mu          sync.Mutex
+	proxies     []*proxyState
+	strategy    ProxySelectStrategy
+	next        int
+	maxFailures int64
+}
+
+// NewProxyPool create a pool with the proxies, a proxy is taken out of rotation after 3 failures in a row
+func NewProxyPool(strategy ProxySelectStrategy, proxies ...*url.URL) *ProxyPool {
+	pp := &ProxyPool{strategy: strategy, maxFailures: 3}
+	for _, proxy := range proxies {
+		pp.proxies = append(pp.proxies, &proxyState{
+			url:    proxy,
+			health: ProxyHealth{URL: proxy.Redacted(), Healthy: true},
+		})
+	}
+	return pp
+}
+
+// SetMaxFailures set the number of failures in a row taking a proxy out of rotation
+func (pp *ProxyPool) SetMaxFailures(n int) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.maxFailures = int64(n)
+}
+
+// Select return a healthy proxy, ErrNoProxyAvailable if all the proxies are unhealthy
+func (pp *ProxyPool) Select() (*url.URL, error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+
+	var selected *proxyState
+	switch pp.strategy {
+	case ProxyLeastFailures:
+		for _, p := range pp.proxies {
+			if p.health.Healthy && (selected == nil || p.health.Failures < selected.health.Failures) {
+				selected = p
+			}
+		}
+	default:
+		for i := 0; i < len(pp.proxies); i++ {
+			p := pp.proxies[(pp.next+i)%len(pp.proxies)]
+			if p.health.Healthy {
+				selected = p
+				pp.next = (pp.next + i + 1) % len(pp.proxies)
+				break
+			}
+		}
+	}
+	if selected == nil {
+		return nil, ErrNoProxyAvailable
+	}
+	selected.health.Requests++
+	return selected.url, nil
+}
+
+// Report record the result of a request sent through the proxy
+func (pp *ProxyPool) Report(proxy *url.URL, err error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	p := pp.find(proxy)
+	if p == nil {
+		return
+	}
+	if err == nil {
+		p.health.ConsecutiveFailures = 0
+		return
+	}
+	p.health.Failures++
+	p.health.ConsecutiveFailures++
+	p.health.LastError = err.Error()
+	if pp.maxFailures > 0 && p.health.ConsecutiveFailures >= pp.maxFailures {
+		p.health.Healthy = false
+	}
+}
+
+func (pp *ProxyPool) find(proxy *url.URL) *proxyState {
+	for _, p := range pp.proxies {
+		if p.url.String() == proxy.String() {
+			return p
+		}
+	}
+	return nil
+}
+
+// Health return the health reports of all the proxies, the passwords in the urls are redacted
+func (pp *ProxyPool) Health() []ProxyHealth {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	health := make([]ProxyHealth, 0, len(pp.proxies))
+	for _, p := range pp.proxies {
+		health = append(health, p.health)
+	}
+	return health
+}
+
+// CheckHealth request checkUrl through every proxy, the proxy is healthy if any response
+// with status < 500 is received in timeout. DefaultProxyCheckUrl is used if checkUrl is empty.
+func (pp *ProxyPool) CheckHealth(ctx context.Context, checkUrl string, timeout time.Duration) {
+	if len(checkUrl) == 0 {
+		checkUrl = DefaultProxyCheckUrl
+	}
+	pp.mu.Lock()
+	proxies := make([]*url.URL, 0, len(pp.proxies))
+	for _, p := range pp.proxies {
+		proxies = append(proxies, p.url)
+	}
+	pp.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proxy := range proxies {
+		wg.Add(1)
+		go func(proxy *url.URL) {
+			defer wg.Done()
+			err := checkProxy(ctx, proxy, checkUrl, timeout)
+			pp.mu.Lock()
+			defer pp.mu.Unlock()
+			if p := pp.find(proxy); p != nil {
+				p.health.LastCheck = time.Now()
+				p.health.Healthy = err == nil
+				if err == nil {
+					p.health.ConsecutiveFailures = 0
+				} else {
+					p.health.LastError = err.Error()
+				}
+			}
+		}(proxy)
+	}
+	wg.Wait()
+}
+
+func checkProxy(ctx context.Context, proxy *url.URL, checkUrl string, timeout time.Duration) error {
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{Proxy: http.ProxyURL(proxy)},
+	}
+	defer client.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", checkUrl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, URL: checkUrl}
+	}
+	return nil
+}
+
+// StartHealthCheck run CheckHealth every interval in a goroutine until ctx is done
+func (pp *ProxyPool) StartHealthCheck(ctx context.Context, interval time.Duration, checkUrl string, timeout time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pp.CheckHealth(ctx, checkUrl, timeout)
+			}
+		}
+	}()
+}
+
+type proxyRoute struct {
+	pattern string
+	pool    *ProxyPool
+}
+
+// ProxyRouter route the requests to the proxy pools by the host, e.g. the api goes
+// direct while the images go through a proxy pool:
+//
+//	router := NewProxyRouter(nil).Route("i.pximg.net", imagePool)
+//	client := NewPixivClientWithOptions(WithProxyRouter(router))
+type ProxyRouter struct {
+	routes       []proxyRoute
+	defaultRoute *ProxyPool
+}
+
+// NewProxyRouter create a router using defaultPool for the hosts matching no route, nil means direct
+func NewProxyRouter(defaultPool *ProxyPool) *ProxyRouter {
+	return &ProxyRouter{defaultRoute: defaultPool}
+}
+
+// Route add a route, the pattern is a host like "i.pximg.net" or a domain suffix like "*.pximg.net",
+// nil pool means direct. The routes are matched in the order they are added.
+func (r *ProxyRouter) Route(pattern string, pool *ProxyPool) *ProxyRouter {
+	r.routes = append(r.routes, proxyRoute{pattern: strings.ToLower(pattern), pool: pool})
+	return r
+}
+
+func (r *ProxyRouter) poolFor(host string) *ProxyPool {
+	host = strings.ToLower(host)
+	for _, route := range r.routes {
+		if suffix, ok := strings.CutPrefix(route.pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) || host == strings.TrimPrefix(suffix, ".") {
+				return route.pool
+			}
+		} else if host == route.pattern {
+			return route.pool
+		}
+	}
+	return r.defaultRoute
+}
+
+type proxyHolderKey struct{}
+
+// proxyHolder receive the proxy selected for a request, so that the result can be reported
+type proxyHolder struct {
+	pool  *ProxyPool
+	proxy *url.URL
+}
+
+// Proxy select the proxy for the request, it can be used as http.Transport.Proxy
+func (r *ProxyRouter) Proxy(req *http.Request) (*url.URL, error) {
+	pool := r.poolFor(req.URL.Hostname())
+	if pool == nil {
+		return nil, nil
+	}
+	proxy, err := pool.Select()
+	if err != nil {
+		return nil, err
+	}
+	if holder, ok := req.Context().Value(proxyHolderKey{}).(*proxyHolder); ok {
+		holder.pool = pool
+		holder.proxy = proxy
+	}
+	return proxy, nil
+}
+
+// proxyReportTransport report the transport errors to the pool of the selected proxy
+type proxyReportTransport struct {
+	next http.RoundTripper
+}
+
+func (t *proxyReportTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	holder := &proxyHolder{}
+	req = req.WithContext(context.WithValue(req.Context(), proxyHolderKey{}, holder))
+	resp, err := t.next.RoundTrip(req)
+	if holder.pool != nil && req.Context().Err() == nil {
+		holder.pool.Report(holder.proxy, err)
+	}
+	return resp, err
+}
@@ -0,0 +1,70 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyRouter(t *testing.T) {
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		if r.URL.Host != "img.test" {
+			t.Errorf("unexpected proxied request: %s", r.URL)
+		}
+		_, _ = w.Write([]byte("image"))
+	}))
+	defer proxy.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer api.Close()
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadUrl, _ := url.Parse(dead.URL)
+	dead.Close()
+	proxyUrl, _ := url.Parse(proxy.URL)
+
+	pool := NewProxyPool(ProxyRoundRobin, deadUrl, proxyUrl)
+	pool.SetMaxFailures(1)
+	router := NewProxyRouter(nil).Route("*.test", pool)
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: api.URL}), WithProxyRouter(router))
+
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetIllustData("http://img.test/1.jpg"); err == nil {
+		t.Errorf("expected error through the dead proxy")
+	}
+	for i := 0; i < 3; i++ {
+		data, err := client.GetIllustData("http://img.test/1.jpg")
+		if err != nil || string(data) != "image" {
+			t.Fatalf("unexpected response: %s, err: %v", data, err)
+		}
+	}
+	if proxied != 3 {
+		t.Errorf("expected 3 proxied requests, acture: %d", proxied)
+	}
+
+	health := pool.Health()
+	if health[0].Healthy || health[0].Failures != 1 || !health[1].Healthy || health[1].Requests != 3 {
+		t.Errorf("unexpected health: %+v", health)
+	}
+
+	pool.CheckHealth(context.Background(), "http://img.test/", time.Second)
+	health = pool.Health()
+	if health[0].Healthy || !health[1].Healthy || health[1].LastCheck.IsZero() {
+		t.Errorf("unexpected health after check: %+v", health)
+	}
+
+	empty := NewProxyPool(ProxyLeastFailures)
+	if _, err := empty.Select(); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("expected: %v, acture: %v", ErrNoProxyAvailable, err)
+	}
+}
@@ -0,0 +1,133 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket rate limiter, it is safe for concurrent use
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	stats  RateLimiterStats
+}
+
+// RateLimiterStats is the statistics of a RateLimiter
+type RateLimiterStats struct {
+	// Requests is the number of Wait calls
+	Requests int64
+	// Waited is the number of Wait calls which have to wait for a token
+	Waited int64
+	// Canceled is the number of Wait calls aborted by the context
+	Canceled int64
+	// WaitTime is the total time spent waiting
+	WaitTime time.Duration
+}
+
+// NewRateLimiter create a limiter allowing rate requests per second with bursts of at most burst requests
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait block until a token is available or the context is done, it never blocks if rate <= 0
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	l.stats.Requests++
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		l.stats.Waited++
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	start := time.Now()
+	err := sleepContext(ctx, delay)
+
+	l.mu.Lock()
+	l.stats.WaitTime += time.Since(start)
+	if err != nil {
+		// give back the reserved token
+		l.tokens++
+		l.stats.Canceled++
+	}
+	l.mu.Unlock()
+	return err
+}
+
+// Stats return a snapshot of the statistics
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+// RateLimitStats is the statistics of the api and image rate limiters of the client,
+// the stats of a disabled limiter is always zero
+type RateLimitStats struct {
+	Api   RateLimiterStats
+	Image RateLimiterStats
+}
+
+// RateLimitStats return the statistics of the rate limiters
+func (p *PixivClient) RateLimitStats() RateLimitStats {
+	var stats RateLimitStats
+	if p.apiLimiter != nil {
+		stats.Api = p.apiLimiter.Stats()
+	}
+	if p.imageLimiter != nil {
+		stats.Image = p.imageLimiter.Stats()
+	}
+	return stats
+}
+
+// waitRateLimit wait for the limiter of the request host, the image limiter is used for
+// the image host (i.pximg.net or the Image base url), the api limiter for the others
+func (p *PixivClient) waitRateLimit(ctx context.Context, u *url.URL) error {
+	limiter := p.apiLimiter
+	if p.isImageHost(u) {
+		limiter = p.imageLimiter
+	}
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(ctx)
+}
+
+func (p *PixivClient) isImageHost(u *url.URL) bool {
+	if host := u.Hostname(); host == "pximg.net" || strings.HasSuffix(host, ".pximg.net") {
+		return true
+	}
+	base, err := url.Parse(p.BaseUrls().Image)
+	return err == nil && base.Host == u.Host
+}
@@ -0,0 +1,65 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cost := time.Since(start); cost < 90*time.Millisecond {
+		t.Errorf("expected cost >= 100ms, acture: %s", cost)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter = NewRateLimiter(0.1, 1)
+	_ = limiter.Wait(ctx)
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: %v, acture: %v", context.DeadlineExceeded, err)
+	}
+
+	stats := limiter.Stats()
+	if stats.Requests != 2 || stats.Waited != 1 || stats.Canceled != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestIsImageHost(t *testing.T) {
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Image: "http://127.0.0.1:8080"}))
+	var testCase = []struct {
+		url      string
+		expected bool
+	}{
+		{"https://i.pximg.net/img-original/img/1_p0.jpg", true},
+		{"https://pximg.net/1.jpg", true},
+		{"https://notpximg.net/1.jpg", false},
+		{"http://127.0.0.1:8080/img-original/img/1_p0.jpg", true},
+		{"https://www.pixiv.net/ajax/illust/1", false},
+	}
+
+	// isImageHost must not race with the setters
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			client.SetBaseUrls(BaseUrls{Image: "http://127.0.0.1:8080"})
+		}
+	}()
+	for _, tc := range testCase {
+		u, _ := url.Parse(tc.url)
+		if client.isImageHost(u) != tc.expected {
+			t.Errorf("%s expected: %v", tc.url, tc.expected)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,113 @@
+package pixiv_api_go
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var served int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&served, 1)
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "new-secret"})
+		if n == 1 {
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"1":null}}}`))
+		} else {
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"1":null,"2":null}}}`))
+		}
+	}))
+	defer server.Close()
+
+	fixture := filepath.Join(t.TempDir(), "testdata", "illusts.json")
+	rec, err := NewRecorder(fixture, RecordModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewPixivClientWithOptions(WithTransport(rec), WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithCookiePHPSESSID("secret"), WithRequestCoalescing(false))
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetUserIllusts("1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("the cookies are not scrubbed: %s", data)
+	}
+
+	rec, err = NewRecorder(fixture, RecordModeReplayStrict, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = NewPixivClientWithOptions(WithTransport(rec), WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithRetryPolicy(RetryPolicy{}), WithRequestCoalescing(false))
+	// replayed in the recorded order, the last one is repeated
+	for _, expected := range []int{1, 2, 2} {
+		illusts, err := client.GetUserIllusts("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(illusts) != expected {
+			t.Errorf("expected: %d, acture: %d", expected, len(illusts))
+		}
+	}
+	if served != 2 {
+		t.Errorf("expected 2 requests served, acture: %d", served)
+	}
+
+	if _, err := client.GetUserIllusts("2"); !errors.Is(err, ErrNoRecordedResponse) {
+		t.Errorf("expected: %v, acture: %v", ErrNoRecordedResponse, err)
+	}
+}
+
+func TestRecorderScrub(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"access_token":"secret-access","refresh_token":"secret-refresh","expires_in":3600}` +
+			`<meta content='{"token":"secret-csrf"}'><script>"{\"token\":\"secret-next\"}"</script>`))
+	}))
+	defer server.Close()
+
+	fixture := filepath.Join(t.TempDir(), "token.json")
+	rec, err := NewRecorder(fixture, RecordModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+	resp, err := client.Get(server.URL + "/token?code=secret-code&id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err = NewRecorder(fixture, RecordModeReplayStrict, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range rec.interactions {
+		if strings.Contains(in.Request.URL, "secret") || strings.Contains(string(in.Response.Body), "secret") {
+			t.Errorf("the tokens are not scrubbed: %s %s", in.Request.URL, in.Response.Body)
+		}
+	}
+	// the request with another code still matches the scrubbed url
+	client = &http.Client{Transport: rec}
+	resp, err = client.Get(server.URL + "/token?code=other&id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,133 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// RequestOptions override the client config for the requests sent with the context,
+// other in-flight requests of the client are not affected
+type RequestOptions struct {
+	// Header is added to the request, it overrides the client header with the same key
+	Header map[string]string
+	// Cookie is added to the request, it overrides the client cookie with the same name,
+	// e.g. {"PHPSESSID": "..."} to use a different session
+	Cookie map[string]string
+	// Lang overrides the lang param if not empty
+	Lang string
+}
+
+type requestOptionsKey struct{}
+
+// ContextWithRequestOptions return a context carrying the request options, the options
+// are merged with the ones already in ctx, e.g.
+//
+//	ctx := ContextWithRequestOptions(ctx, RequestOptions{Lang: "en"})
+//	illusts, err := client.GetIllustInfoWithContext(ctx, illustId, false)
+func ContextWithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	if parent, ok := ctx.Value(requestOptionsKey{}).(*RequestOptions); ok {
+		merged := RequestOptions{
+			Header: mergeMap(parent.Header, opts.Header),
+			Cookie: mergeMap(parent.Cookie, opts.Cookie),
+			Lang:   parent.Lang,
+		}
+		if len(opts.Lang) > 0 {
+			merged.Lang = opts.Lang
+		}
+		opts = merged
+	} else {
+		opts.Header = copyMap(opts.Header)
+		opts.Cookie = copyMap(opts.Cookie)
+	}
+	return context.WithValue(ctx, requestOptionsKey{}, &opts)
+}
+
+func requestOptionsFromContext(ctx context.Context) *RequestOptions {
+	opts, _ := ctx.Value(requestOptionsKey{}).(*RequestOptions)
+	return opts
+}
+
+// requestHeaderAndSessionCookie return the client headers and cookies merged with the
+// request options in ctx, the returned maps must not be modified. The cookies of the
+// session from the pool override the client cookies, and the request options override both
+func (p *PixivClient) requestHeaderAndSessionCookie(ctx context.Context, s *pooledSession) (map[string]string, map[string]string) {
+	p.mu.RLock()
+	header, cookie := p.Header, p.Cookie
+	p.mu.RUnlock()
+
+	if s != nil {
+		cookie = mergeMap(cookie, s.Cookie)
+	}
+	if opts := requestOptionsFromContext(ctx); opts != nil {
+		if len(opts.Header) > 0 {
+			header = mergeMap(header, opts.Header)
+		}
+		if len(opts.Cookie) > 0 {
+			cookie = mergeMap(cookie, opts.Cookie)
+		}
+	}
+	return header, cookie
+}
+
+// addRequestCookies add the cookies returned by requestCookies to the request
+func (p *PixivClient) addRequestCookies(ctx context.Context, req *http.Request, s *pooledSession, cookie map[string]string) {
+	for k, v := range p.requestCookies(ctx, req.URL, s, cookie) {
+		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	}
+}
+
+// requestCookies return the cookies sent to u, cookie is the result of requestHeaderAndSessionCookie.
+// The cookies in the jar override the client cookies as they are the refreshed ones, but never
+// override the request options. The jar is shared by the client, so it is skipped for the
+// session from the pool, whose cookies are not refreshed by the responses.
+func (p *PixivClient) requestCookies(ctx context.Context, u *url.URL, s *pooledSession, cookie map[string]string) map[string]string {
+	if p.jar == nil || s != nil {
+		return cookie
+	}
+	var explicit map[string]string
+	if opts := requestOptionsFromContext(ctx); opts != nil {
+		explicit = opts.Cookie
+	}
+	cookie = copyMap(cookie)
+	for _, c := range p.jar.Cookies(u) {
+		if _, ok := explicit[c.Name]; !ok {
+			cookie[c.Name] = c.Value
+		}
+	}
+	return cookie
+}
+
+// sentSessionId return the PHPSESSID sent to the url, the keys of the cache, the coalescing
+// and the csrf tokens are told apart by it
+func (p *PixivClient) sentSessionId(ctx context.Context, urlStr string, s *pooledSession) string {
+	_, cookie := p.requestHeaderAndSessionCookie(ctx, s)
+	if u, err := url.Parse(urlStr); err == nil {
+		cookie = p.requestCookies(ctx, u, s, cookie)
+	}
+	return cookie["PHPSESSID"]
+}
+
+func (p *PixivClient) requestLang(ctx context.Context) string {
+	if opts := requestOptionsFromContext(ctx); opts != nil && len(opts.Lang) > 0 {
+		return opts.Lang
+	}
+	return p.GetLang()
+}
+
+func copyMap(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// mergeMap return a new map with the entries of a and b, b wins on the same key
+func mergeMap(a, b map[string]string) map[string]string {
+	c := copyMap(a)
+	for k, v := range b {
+		c[k] = v
+	}
+	return c
+}
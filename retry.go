@@ -0,0 +1,148 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decide whether and when a failed idempotent request (GET) will be retried
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first one, retry is disabled if MaxAttempts <= 1
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it is doubled after every attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay and the Retry-After delay, zero means no cap
+	MaxDelay time.Duration
+	// Jitter randomize the delay in [delay*(1-Jitter), delay], in range [0, 1]
+	Jitter float64
+	// RetryableStatus is the status codes that can be retried, DefaultRetryableStatus is used if nil
+	RetryableStatus []int
+	// RetryableError report whether a network error can be retried, IsRetryableNetErr is used if nil
+	RetryableError func(err error) bool
+}
+
+// DefaultRetryableStatus is the status codes retried by default
+var DefaultRetryableStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy retry at most 2 times with 500ms, 1s backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.2,
+}
+
+// IsRetryableNetErr report whether the error is a transient network error, e.g. timeout, connection reset
+func IsRetryableNetErr(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+func (rp *RetryPolicy) enabled() bool {
+	return rp != nil && rp.MaxAttempts > 1
+}
+
+func (rp *RetryPolicy) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if resp != nil {
+		statusList := rp.RetryableStatus
+		if statusList == nil {
+			statusList = DefaultRetryableStatus
+		}
+		for _, status := range statusList {
+			if resp.StatusCode == status {
+				return true
+			}
+		}
+		return false
+	}
+	if rp.RetryableError != nil {
+		return rp.RetryableError(err)
+	}
+	return IsRetryableNetErr(err)
+}
+
+// delay return the wait duration before the next attempt, attempt starts from 1
+func (rp *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if rp.MaxDelay > 0 && d > rp.MaxDelay {
+				d = rp.MaxDelay
+			}
+			return d
+		}
+	}
+
+	d := rp.BaseDelay
+	for i := 1; i < attempt && (rp.MaxDelay <= 0 || d < rp.MaxDelay); i++ {
+		d *= 2
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	if rp.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * rp.Jitter * float64(d))
+	}
+	return d
+}
+
+// parseRetryAfter parse the Retry-After header, both delay-seconds and HTTP-date are supported
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if len(value) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleepContext wait for d, return ctx.Err() if the context is done before that
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
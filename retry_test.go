@@ -0,0 +1,64 @@
+package pixiv_api_go
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&count, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+		}
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond}
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithRetryPolicy(policy))
+	if _, err := client.GetUserIllusts("1"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("expected attempts: 3, acture: %d", count)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	policy.MaxAttempts = 2
+	client = NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithRetryPolicy(policy))
+	if _, err := client.GetUserIllusts("1"); err == nil {
+		t.Errorf("expected error after 2 attempts")
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+	var testCase = []struct {
+		attempt    int
+		retryAfter string
+		expected   time.Duration
+	}{
+		{1, "", time.Second},
+		{2, "", 2 * time.Second},
+		{3, "", 3 * time.Second},
+		{1, "2", 2 * time.Second},
+		{1, "120", 3 * time.Second},
+	}
+
+	for _, tc := range testCase {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", tc.retryAfter)
+		if d := policy.delay(tc.attempt, resp); d != tc.expected {
+			t.Errorf("attempt: %d, retry-after: %s, expected: %s, acture: %s", tc.attempt, tc.retryAfter, tc.expected, d)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Session is a pixiv account used by SessionPool
+type Session struct {
+	// Name identify the session in the pool, e.g. the account name
+	Name string
+	// Cookie is sent with the requests using this session, it must contain PHPSESSID
+	Cookie map[string]string
+}
+
+// SessionHealth is the health report of a session in the pool
+type SessionHealth struct {
+	Name          string
+	Requests      int64
+	Failures      int64
+	RateLimited   int64
+	LoggedOut     bool // the last request got 401 or a login required error
+	CooldownUntil time.Time
+	LastError     string
+}
+
+// Available reports whether the session is not cooling down
+func (h SessionHealth) Available() bool {
+	return time.Now().After(h.CooldownUntil)
+}
+
+type pooledSession struct {
+	Session
+	health SessionHealth
+}
+
+// SessionPool spread the requests across multiple accounts in round-robin. The account
+// getting rate limited or logged out is put on cooldown and skipped until the cooldown ends.
+// The write requests (non GET) are pinned to the write session if it is set.
+type SessionPool struct {
+	mu                sync.Mutex
+	sessions          []*pooledSession
+	next              int
+	writeSession      string
+	rateLimitCooldown time.Duration
+	loggedOutCooldown time.Duration
+}
+
+// NewSessionPool create a pool with the sessions, the default cooldown is 5 minutes for
+// rate limited and 1 hour for logged out
+func NewSessionPool(sessions ...Session) *SessionPool {
+	sp := &SessionPool{
+		rateLimitCooldown: 5 * time.Minute,
+		loggedOutCooldown: time.Hour,
+	}
+	for _, s := range sessions {
+		sp.Add(s)
+	}
+	return sp
+}
+
+// SetCooldown set the cooldown durations for the rate limited and the logged out sessions
+func (sp *SessionPool) SetCooldown(rateLimited, loggedOut time.Duration) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.rateLimitCooldown = rateLimited
+	sp.loggedOutCooldown = loggedOut
+}
+
+// Add add the session to the pool, the session with the same name is replaced and its health is reset
+func (sp *SessionPool) Add(s Session) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	ps := &pooledSession{
+		Session: Session{Name: s.Name, Cookie: copyMap(s.Cookie)},
+		health:  SessionHealth{Name: s.Name},
+	}
+	for i, old := range sp.sessions {
+		if old.Name == s.Name {
+			sp.sessions[i] = ps
+			return
+		}
+	}
+	sp.sessions = append(sp.sessions, ps)
+}
+
+func (sp *SessionPool) Remove(name string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	for i, s := range sp.sessions {
+		if s.Name == name {
+			sp.sessions = append(sp.sessions[:i], sp.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetWriteSession pin the write requests to the named session, empty name means round-robin
+func (sp *SessionPool) SetWriteSession(name string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.writeSession = name
+}
+
+// Health return the health reports of all the sessions
+func (sp *SessionPool) Health() []SessionHealth {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	health := make([]SessionHealth, 0, len(sp.sessions))
+	for _, s := range sp.sessions {
+		health = append(health, s.health)
+	}
+	return health
+}
+
+// pick return the session pinned by ctx, or the write session for write requests,
+// otherwise the next available session in round-robin
+func (sp *SessionPool) pick(ctx context.Context, write bool) (*pooledSession, error) {
+	if sp == nil {
+		return nil, nil
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	name := pinnedSession(ctx)
+	if len(name) == 0 && write {
+		name = sp.writeSession
+	}
+	if len(name) > 0 {
+		for _, s := range sp.sessions {
+			if s.Name == name {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: session %s not in the pool", ErrNoSessionAvailable, name)
+	}
+
+	now := time.Now()
+	for i := 0; i < len(sp.sessions); i++ {
+		s := sp.sessions[(sp.next+i)%len(sp.sessions)]
+		if now.After(s.health.CooldownUntil) {
+			sp.next = (sp.next + i + 1) % len(sp.sessions)
+			return s, nil
+		}
+	}
+	return nil, ErrNoSessionAvailable
+}
+
+// report update the health of the session by the request result
+func (sp *SessionPool) report(s *pooledSession, err error) {
+	if sp == nil || s == nil {
+		return
+	}
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	s.health.Requests++
+	if err == nil {
+		s.health.LoggedOut = false
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+	s.health.Failures++
+	s.health.LastError = err.Error()
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		s.health.RateLimited++
+		s.health.CooldownUntil = time.Now().Add(sp.rateLimitCooldown)
+	case errors.Is(err, ErrLoginRequired):
+		s.health.LoggedOut = true
+		s.health.CooldownUntil = time.Now().Add(sp.loggedOutCooldown)
+	}
+}
+
+type pinnedSessionKey struct{}
+
+// ContextWithSession pin the requests sent with the context to the named session of the pool
+func ContextWithSession(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, pinnedSessionKey{}, name)
+}
+
+type pickedSessionKey struct{}
+
+// pickedSessionHolder receive the session picked for the request, so that the errors
+// found after the response is parsed can be reported to the session
+type pickedSessionHolder struct {
+	mu        sync.Mutex
+	session   *pooledSession
+	preferred *pooledSession
+	// deferErrors is set before the requests are sent if the failed attempts are
+	// reported by the caller too
+	deferErrors bool
+}
+
+func withPickedSessionHolder(ctx context.Context) (context.Context, *pickedSessionHolder) {
+	holder := &pickedSessionHolder{}
+	return context.WithValue(ctx, pickedSessionKey{}, holder), holder
+}
+
+// reportedByHolder reports whether the result of an attempt is left to the caller holding
+// the picked session, the success always is and the errors only if deferErrors is set
+func reportedByHolder(ctx context.Context, err error) bool {
+	holder, ok := ctx.Value(pickedSessionKey{}).(*pickedSessionHolder)
+	return ok && (err == nil || holder.deferErrors)
+}
+
+func (h *pickedSessionHolder) set(s *pooledSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.session = s
+}
+
+func (h *pickedSessionHolder) get() *pooledSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.session
+}
+
+// takePreferred return the preferred session once, nil if it is not set or already taken
+func (h *pickedSessionHolder) takePreferred() *pooledSession {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.preferred
+	h.preferred = nil
+	return s
+}
+
+// preferSession pick the session of the first attempt before the request is sent, so that
+// the cache and coalescing keys are told apart by the session actually used. The retries
+// pick the sessions in round-robin as usual. nil is returned if the client has no session
+// pool or no session is available, the error is returned when the request is sent.
+func (p *PixivClient) preferSession(ctx context.Context, holder *pickedSessionHolder) *pooledSession {
+	if p.sessions == nil {
+		return nil
+	}
+	s, err := p.sessions.pick(ctx, false)
+	if err != nil {
+		return nil
+	}
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	holder.preferred = s
+	return s
+}
+
+// pickSession pick a session from the pool and record it in the holder of ctx if any,
+// the preferred session of the holder is used for the first attempt. nil is returned if
+// the client has no session pool.
+func (p *PixivClient) pickSession(ctx context.Context, write bool) (*pooledSession, error) {
+	if p.sessions == nil {
+		return nil, nil
+	}
+	holder, ok := ctx.Value(pickedSessionKey{}).(*pickedSessionHolder)
+	var s *pooledSession
+	if ok {
+		s = holder.takePreferred()
+	}
+	if s == nil {
+		var err error
+		if s, err = p.sessions.pick(ctx, write); err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		holder.set(s)
+	}
+	return s, nil
+}
+
+// sessionName return the name of the session, empty if nil
+func sessionName(s *pooledSession) string {
+	if s == nil {
+		return ""
+	}
+	return s.Name
+}
+
+// pinnedSession return the name of the session ctx is pinned to, empty if none
+func pinnedSession(ctx context.Context) string {
+	name, _ := ctx.Value(pinnedSessionKey{}).(string)
+	return name
+}
+
+// SessionPool return the session pool of the client, nil if it is not set
+func (p *PixivClient) SessionPool() *SessionPool {
+	return p.sessions
+}
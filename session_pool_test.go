@@ -0,0 +1,180 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionPool(t *testing.T) {
+	var mu sync.Mutex
+	used := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		mu.Lock()
+		used[c.Value]++
+		mu.Unlock()
+		switch c.Value {
+		case "b":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "c":
+			_, _ = w.Write([]byte(`{"error":true,"message":"ログインしてください","body":[]}`))
+		default:
+			_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+		}
+	}))
+	defer server.Close()
+
+	pool := NewSessionPool(
+		Session{Name: "a", Cookie: map[string]string{"PHPSESSID": "a"}},
+		Session{Name: "b", Cookie: map[string]string{"PHPSESSID": "b"}},
+		Session{Name: "c", Cookie: map[string]string{"PHPSESSID": "c"}},
+	)
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithSessionPool(pool),
+		WithRequestCoalescing(false),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+
+	for i := 0; i < 6; i++ {
+		_, _ = client.GetUserIllusts("1")
+	}
+	if used["b"] != 1 || used["c"] != 1 || used["a"] != 5 {
+		t.Errorf("unexpected session usage: %v", used)
+	}
+	for _, h := range pool.Health() {
+		switch h.Name {
+		case "a":
+			if !h.Available() || h.Failures != 0 {
+				t.Errorf("unexpected health: %+v", h)
+			}
+		case "b":
+			if h.Available() || h.RateLimited != 1 {
+				t.Errorf("unexpected health: %+v", h)
+			}
+		case "c":
+			if h.Available() || !h.LoggedOut || h.Requests != 1 {
+				t.Errorf("unexpected health: %+v", h)
+			}
+		}
+	}
+
+	_, err := client.GetUserIllustsWithContext(ContextWithSession(context.Background(), "b"), "1")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected pinned session rate limited, acture: %v", err)
+	}
+
+	pool.Remove("a")
+	if _, err := client.GetUserIllusts("1"); !errors.Is(err, ErrNoSessionAvailable) {
+		t.Errorf("expected: %v, acture: %v", ErrNoSessionAvailable, err)
+	}
+}
+
+func TestSessionPoolCacheAndCoalescing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"` + c.Value + `":null}}}`))
+	}))
+	defer server.Close()
+
+	pool := NewSessionPool(
+		Session{Name: "a", Cookie: map[string]string{"PHPSESSID": "1"}},
+		Session{Name: "b", Cookie: map[string]string{"PHPSESSID": "2"}},
+	)
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithSessionPool(pool),
+		WithCache(NewLRUCache(10), nil),
+	)
+
+	// the unpinned request is coalesced or cached with the request of the session it picked,
+	// the requests of a and b are neither coalesced nor cached together
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		for _, name := range []string{"", "a", "b"} {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				ctx := context.Background()
+				if len(name) > 0 {
+					ctx = ContextWithSession(ctx, name)
+				}
+				illusts, err := client.GetUserIllustsWithContext(ctx, "1")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(illusts) != 1 {
+					t.Errorf("session %s got %v", name, illusts)
+					return
+				}
+				expected := map[string]PixivID{"a": "1", "b": "2"}[name]
+				if len(name) > 0 && illusts[0] != expected {
+					t.Errorf("session %s got %v", name, illusts)
+				}
+			}(name)
+		}
+		wg.Wait()
+	}
+
+	// the unpinned requests of both sessions are cached
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetUserIllusts("1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the first request of every session is sent
+	var total int64
+	for _, h := range pool.Health() {
+		total += h.Requests
+	}
+	if total != 2 {
+		t.Errorf("expected 2 requests, acture: %d", total)
+	}
+}
+
+func TestSessionPoolCookieJar(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("PHPSESSID")
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "refreshed-" + c.Value, Path: "/"})
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":{"` + c.Value + `":null}}}`))
+	}))
+	defer server.Close()
+
+	pool := NewSessionPool(
+		Session{Name: "a", Cookie: map[string]string{"PHPSESSID": "1"}},
+		Session{Name: "b", Cookie: map[string]string{"PHPSESSID": "2"}},
+	)
+	jar := NewPersistentJar("127.0.0.1")
+	client := NewPixivClientWithOptions(
+		WithBaseUrls(BaseUrls{Web: server.URL}),
+		WithSessionPool(pool),
+		WithCookieJar(jar),
+		WithRequestCoalescing(false),
+	)
+
+	// the cookies set for a session are not sent by the other sessions
+	for _, name := range []string{"a", "b", "a"} {
+		ctx := ContextWithSession(context.Background(), name)
+		illusts, err := client.GetUserIllustsWithContext(ctx, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]PixivID{"a": "1", "b": "2"}[name]
+		if len(illusts) != 1 || illusts[0] != expected {
+			t.Errorf("session %s got %v", name, illusts)
+		}
+	}
+	u, _ := url.Parse(server.URL)
+	if cookies := jar.Cookies(u); len(cookies) != 0 {
+		t.Errorf("expected the jar untouched by the sessions, acture: %v", cookies)
+	}
+}
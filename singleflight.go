@@ -0,0 +1,99 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	neturl "net/url"
+	"sort"
+	"sync"
+)
+
+// flightGroup coalesce the concurrent calls with the same key into one call, the result
+// is shared by all the callers. It is like golang.org/x/sync/singleflight, but every
+// caller can give up waiting with its own context, and the shared call is canceled
+// only when all the callers gave up.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	val     []byte
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do call fn once for the concurrent calls with the same key, fn is called with a context
+// carrying the values of ctx but not canceled by it. shared reports whether the result
+// is shared with other callers.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) (val []byte, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	call, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go func() {
+			call.val, call.err = fn(callCtx)
+			cancel()
+			g.mu.Lock()
+			// the call may have been abandoned and replaced by a new one
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		g.mu.Lock()
+		shared = call.waiters > 1 || ok
+		g.mu.Unlock()
+		return call.val, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// the new callers must not join the canceled call
+			call.cancel()
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, false, ctx.Err()
+	}
+}
+
+// flightKey identify the requests can be coalesced, the requests with different
+// headers, cookies (e.g. overridden by RequestOptions or refreshed in the jar) or sessions
+// are never coalesced
+func (p *PixivClient) flightKey(ctx context.Context, endpoint, url, refer string, s *pooledSession) string {
+	header, cookie := p.requestHeaderAndSessionCookie(ctx, s)
+	if u, err := neturl.Parse(url); err == nil {
+		cookie = p.requestCookies(ctx, u, s, cookie)
+	}
+	h := sha1.New()
+	for _, m := range []map[string]string{header, cookie} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			h.Write([]byte(k + "\x00" + m[k] + "\x00"))
+		}
+		h.Write([]byte{0xff})
+	}
+	return endpoint + " " + url + " " + refer + " " + sessionName(s) + " " + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package pixiv_api_go
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"error":false,"message":"","body":{"illusts":[]}}`))
+	}))
+	defer server.Close()
+
+	client := NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}))
+
+	// the canceled caller must not fail the others
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			callCtx := context.Background()
+			if i == 0 {
+				callCtx = ctx
+			}
+			_, err := client.GetUserIllustsWithContext(callCtx, "1")
+			if i == 0 && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected: %v, acture: %v", context.DeadlineExceeded, err)
+			}
+			if i != 0 && err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if count != 1 {
+		t.Errorf("expected 1 request, acture: %d", count)
+	}
+
+	// the call abandoned by all the callers must not be joined by a new caller
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetUserIllustsWithContext(ctx, "1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected: %v, acture: %v", context.DeadlineExceeded, err)
+	}
+	if _, err := client.GetUserIllustsWithContext(context.Background(), "1"); err != nil {
+		t.Errorf("the abandoned call is joined: %v", err)
+	}
+
+	atomic.StoreInt32(&count, 0)
+	client = NewPixivClientWithOptions(WithBaseUrls(BaseUrls{Web: server.URL}), WithRequestCoalescing(false))
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = client.GetUserIllusts("1")
+		}()
+	}
+	wg.Wait()
+	if count != 3 {
+		t.Errorf("expected 3 requests, acture: %d", count)
+	}
+}
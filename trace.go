@@ -0,0 +1,52 @@
+package pixiv_api_go
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// requestTrace record a logical request, including all the retries
+type requestTrace struct {
+	endpoint string
+	req      *http.Request // the request of the last attempt
+	start    time.Time
+	attempts int
+	status   int
+}
+
+// tracedBody finish the trace when the response body is closed, so that the
+// latency and size include reading the body
+type tracedBody struct {
+	rc     io.ReadCloser
+	client *PixivClient
+	trace  *requestTrace
+	size   int64
+	err    error
+	once   sync.Once
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	b.size += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.rc.Close()
+	b.once.Do(func() {
+		_ = b.client.finishRequest(b.trace, b.size, b.err)
+	})
+	return err
+}
+
+// finishRequest record the finished request and return err as is
+func (p *PixivClient) finishRequest(trace *requestTrace, size int64, err error) error {
+	p.metrics.requestFinished(trace, size)
+	p.logRequest(trace, size, err)
+	return err
+}
@@ -1,6 +1,7 @@
 package pixiv_api_go
 
 import (
+	"context"
 	"crypto/sha1"
 	"crypto/sha256"
 	"fmt"
@@ -92,3 +93,24 @@ func FileSha1Sum(filename string) (string, error) {
 	sum := fmt.Sprintf("%x", h.Sum(nil))
 	return sum, nil
 }
+
+// contextReadCloser fails the reads with ctx.Err() once the context is done
+type contextReadCloser struct {
+	ctx context.Context
+	rc  io.ReadCloser
+}
+
+func (c *contextReadCloser) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.rc.Read(p)
+	if err != nil && err != io.EOF && c.ctx.Err() != nil {
+		return n, c.ctx.Err()
+	}
+	return n, err
+}
+
+func (c *contextReadCloser) Close() error {
+	return c.rc.Close()
+}